@@ -36,8 +36,11 @@ type HashCache interface {
 	Expireat(string, time.Time) error
 	Expire(string, time.Duration) error
 	MExists(string, string) (bool, error)
+	// Deprecated: SetNX locks for 60 seconds without owner, use Locker instead.
 	SetNX(string) (bool, error)
+	// Deprecated: use Locker instead.
 	MSetNX(string, time.Duration, string) (bool, error)
+	// Deprecated: ClearSetNX releases the lock of any owner, use Lock.Release instead.
 	ClearSetNX(string) error
 	// ScanKeys is scan all keys with count (default is 100).
 	// this will return list of keys and error
@@ -76,6 +79,11 @@ type HashCache interface {
 	HmsetPipeline(pipe redis.Pipeliner, params KeyMapValues) error
 }
 
+// Pinger is implemented by caches able to check their connection, e.g. the redis HashCache
+type Pinger interface {
+	Ping() error
+}
+
 //PubSubRedis is
 type PubSubRedis interface {
 	io.Closer
@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultLoaderTTL is the ttl of loaded values
+	DefaultLoaderTTL = 5 * time.Minute
+	// DefaultNegativeTTL is the ttl of keys not found by the loader
+	DefaultNegativeTTL = 30 * time.Second
+	// DefaultEarlyRefreshBeta favors refreshing values a bit before they expire
+	DefaultEarlyRefreshBeta = 1.0
+
+	// hash fields stored by the loader next to the fields of the value
+	loaderExpiryField  = "__cache_expiry"
+	loaderDeltaField   = "__cache_delta"
+	loaderMissingField = "__cache_missing"
+	loaderVersionField = "__cache_version"
+)
+
+// loaderStoreScript replaces the hash KEYS[1] by the fields ARGV[4:] expiring after ARGV[1] ms.
+// With ARGV[2] = "1" the hash is only replaced while its version is still ARGV[3], so
+// values loaded before a Set do not overwrite it, otherwise the version is incremented.
+var loaderStoreScript = redis.NewScript(`
+local version = redis.call('HGET', KEYS[1], '__cache_version') or ''
+if ARGV[2] == '1' then
+	if version ~= ARGV[3] then
+		return 0
+	end
+else
+	version = tostring((tonumber(version) or 0) + 1)
+end
+redis.call('DEL', KEYS[1])
+redis.call('HMSET', KEYS[1], '__cache_version', version, unpack(ARGV, 4))
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+// ErrNotFound is returned by LoadFunc for keys missing from the source, the loader
+// caches it for NegativeTTL
+var ErrNotFound = errors.New("cache: not found")
+
+// LoadFunc loads the value of key from the source of truth, e.g. the database
+type LoadFunc[T any] func(ctx context.Context, key string) (T, error)
+
+// WriteFunc writes the value of key to the source of truth
+type WriteFunc[T any] func(ctx context.Context, key string, value T) error
+
+// LoaderOption configures a Loader, zero fields use their default
+type LoaderOption[T any] struct {
+	// TTL of loaded values, DefaultLoaderTTL when zero
+	TTL time.Duration
+	// NegativeTTL of keys not found, DefaultNegativeTTL when zero, negative disables negative caching
+	NegativeTTL time.Duration
+	// EarlyRefreshBeta scales the probability of refreshing a value before it expires,
+	// according to its load duration. DefaultEarlyRefreshBeta when zero, negative disables it.
+	EarlyRefreshBeta float64
+	// WriteThrough writes values to the source before they are cached by Set
+	WriteThrough WriteFunc[T]
+	// WriteBehind writes values to the source in the background after they are cached by Set
+	WriteBehind WriteFunc[T]
+	// OnError is called with the errors of the cache, of background refreshes and
+	// of write behind, they are not returned to the callers
+	OnError func(key string, err error)
+}
+
+// Loader reads values through the cache: missing values are loaded once for all
+// concurrent callers and cached, values close to expiry are refreshed in the background.
+type Loader[T any] struct {
+	cache  *TypedHashCache[T]
+	load   LoadFunc[T]
+	option LoaderOption[T]
+	group  singleflight.Group
+
+	// writes holds the pending write behind of the keys being written
+	writesMu sync.Mutex
+	writes   map[string]*pendingWrite[T]
+}
+
+// pendingWrite is the next value written behind for a key, nil when none
+type pendingWrite[T any] struct {
+	ctx   context.Context
+	value *T
+}
+
+// NewLoader returns loader caching the values loaded by load in hc, a HashCache made by this package
+func NewLoader[T any](hc HashCache, load LoadFunc[T], option LoaderOption[T]) (*Loader[T], error) {
+	typed, err := NewTypedHashCache[T](hc)
+	if err != nil {
+		return nil, err
+	}
+	if option.TTL == 0 {
+		option.TTL = DefaultLoaderTTL
+	}
+	if option.NegativeTTL == 0 {
+		option.NegativeTTL = DefaultNegativeTTL
+	}
+	if option.EarlyRefreshBeta == 0 {
+		option.EarlyRefreshBeta = DefaultEarlyRefreshBeta
+	}
+	if option.OnError == nil {
+		option.OnError = func(string, error) {}
+	}
+	return &Loader[T]{cache: typed, load: load, option: option, writes: map[string]*pendingWrite[T]{}}, nil
+}
+
+// Get returns the value of key from the cache, loading it on a miss.
+// It returns ErrNotFound for keys the loader did not find.
+// When the cache fails, the value is loaded without it.
+func (l *Loader[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero T
+	var fields map[string]string
+	err := withContext(ctx, func() (err error) {
+		fields, err = l.cache.hc.cmdable().HGetAll(l.cache.hc.realKey(key)).Result()
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return zero, err
+		}
+		l.option.OnError(key, err)
+	}
+
+	if len(fields) > 0 {
+		if fields[loaderMissingField] != "" {
+			return zero, ErrNotFound
+		}
+		value, err := l.cache.Decode(fields)
+		if err == nil {
+			if l.refreshEarly(fields) {
+				go l.refresh(context.WithoutCancel(ctx), key, fields[loaderVersionField])
+			}
+			return value, nil
+		}
+		l.option.OnError(key, err)
+	}
+
+	version := fields[loaderVersionField]
+	ch := l.group.DoChan(key, func() (interface{}, error) {
+		return l.loadAndStore(context.WithoutCancel(ctx), key, version)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// refreshEarly reports whether the value is refreshed before it expires, the
+// probability increases as expiry gets close and with the load duration (XFetch)
+func (l *Loader[T]) refreshEarly(fields map[string]string) bool {
+	if l.option.EarlyRefreshBeta < 0 {
+		return false
+	}
+	expiry, err := strconv.ParseInt(fields[loaderExpiryField], 10, 64)
+	if err != nil {
+		return false
+	}
+	delta, _ := strconv.ParseInt(fields[loaderDeltaField], 10, 64)
+	gap := -float64(delta) * l.option.EarlyRefreshBeta * math.Log(rand.Float64())
+	return float64(time.Now().UnixMilli())+gap >= float64(expiry)
+}
+
+func (l *Loader[T]) refresh(ctx context.Context, key, version string) {
+	_, err, _ := l.group.Do(key, func() (interface{}, error) {
+		return l.loadAndStore(ctx, key, version)
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		l.option.OnError(key, err)
+	}
+}
+
+// loadAndStore loads key and caches the result unless the cached version changed
+// from version meanwhile, failed loads are not cached
+func (l *Loader[T]) loadAndStore(ctx context.Context, key, version string) (interface{}, error) {
+	start := time.Now()
+	value, err := l.load(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		if l.option.NegativeTTL > 0 {
+			l.store(ctx, key, map[string]interface{}{loaderMissingField: "1"}, l.option.NegativeTTL, &version)
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := l.cache.Encode(value)
+	fields[loaderDeltaField] = strconv.FormatInt(time.Since(start).Milliseconds(), 10)
+	l.store(ctx, key, fields, l.option.TTL, &version)
+	return value, nil
+}
+
+// store replaces the hash of key by fields expiring after ttl, errors go to OnError.
+// With version the hash is only replaced while its version is unchanged,
+// otherwise its version is incremented.
+func (l *Loader[T]) store(ctx context.Context, key string, fields map[string]interface{}, ttl time.Duration, version *string) {
+	fields[loaderExpiryField] = strconv.FormatInt(time.Now().Add(ttl).UnixMilli(), 10)
+	args := []interface{}{ttl.Milliseconds(), "0", ""}
+	if version != nil {
+		args[1], args[2] = "1", *version
+	}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	err := writeWithContext(ctx, func() error {
+		return loaderStoreScript.Run(l.cache.hc.cmdable(), []string{l.cache.hc.realKey(key)}, args...).Err()
+	})
+	if err != nil {
+		l.option.OnError(key, err)
+	}
+}
+
+// Set caches value as the value of key. It is written to the source before with WriteThrough,
+// the value is not cached when it fails, or in the background with WriteBehind.
+// The values of key loaded before are not cached over value. The writes behind of
+// a key are done one at a time, a write waiting for the previous one is replaced by
+// the write of the next Set.
+func (l *Loader[T]) Set(ctx context.Context, key string, value T) error {
+	if l.option.WriteThrough != nil {
+		if err := l.option.WriteThrough(ctx, key, value); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fields := l.cache.Encode(value)
+	fields[loaderDeltaField] = "0"
+	l.store(ctx, key, fields, l.option.TTL, nil)
+	l.group.Forget(key)
+
+	if l.option.WriteBehind != nil {
+		l.writeBehind(context.WithoutCancel(ctx), key, value)
+	}
+	return nil
+}
+
+// writeBehind writes value in the background after the running write of key
+func (l *Loader[T]) writeBehind(ctx context.Context, key string, value T) {
+	l.writesMu.Lock()
+	defer l.writesMu.Unlock()
+	if pending, ok := l.writes[key]; ok {
+		pending.ctx, pending.value = ctx, &value
+		return
+	}
+	l.writes[key] = &pendingWrite[T]{}
+	go func() {
+		for {
+			if err := l.option.WriteBehind(ctx, key, value); err != nil {
+				l.option.OnError(key, err)
+			}
+			l.writesMu.Lock()
+			pending := l.writes[key]
+			if pending.value == nil {
+				delete(l.writes, key)
+				l.writesMu.Unlock()
+				return
+			}
+			ctx, value = pending.ctx, *pending.value
+			pending.ctx, pending.value = nil, nil
+			l.writesMu.Unlock()
+		}
+	}()
+}
+
+// Invalidate removes keys from the cache, they are loaded again on their next Get
+func (l *Loader[T]) Invalidate(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		l.group.Forget(key)
+	}
+	return l.cache.Del(ctx, keys...)
+}
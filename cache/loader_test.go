@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+type loaderUser struct {
+	Name string `cache:"name"`
+	Age  int    `cache:"age"`
+}
+
+func TestLoader(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	var loads int32
+	release := make(chan struct{})
+	load := func(ctx context.Context, key string) (loaderUser, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		if key == "missing" {
+			return loaderUser{}, ErrNotFound
+		}
+		if key == "broken" {
+			return loaderUser{}, errors.New("db down")
+		}
+		return loaderUser{Name: key, Age: 30}, nil
+	}
+	loader, err := NewLoader[loaderUser](hc, load, LoaderOption[loaderUser]{
+		TTL:              time.Minute,
+		NegativeTTL:      10 * time.Second,
+		EarlyRefreshBeta: -1,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := loader.Get(ctx, "alice")
+			require.NoError(t, err)
+			require.Equal(t, loaderUser{Name: "alice", Age: 30}, user)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	require.Equal(t, time.Minute, mr.TTL("test:alice"))
+	require.Equal(t, "alice", mr.HGet("test:alice", "name"))
+
+	user, err := loader.Get(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, "alice", user.Name)
+	require.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	_, err = loader.Get(ctx, "missing")
+	require.Equal(t, ErrNotFound, err)
+	_, err = loader.Get(ctx, "missing")
+	require.Equal(t, ErrNotFound, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&loads))
+	require.Equal(t, 10*time.Second, mr.TTL("test:missing"))
+
+	_, err = loader.Get(ctx, "broken")
+	require.EqualError(t, err, "db down")
+	require.False(t, mr.Exists("test:broken"))
+
+	require.NoError(t, loader.Invalidate(ctx, "alice"))
+	_, err = loader.Get(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, int32(4), atomic.LoadInt32(&loads))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = loader.Get(canceled, "alice")
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestLoaderEarlyRefresh(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	var loads int32
+	refreshed := make(chan struct{}, 1)
+	load := func(ctx context.Context, key string) (loaderUser, error) {
+		n := atomic.AddInt32(&loads, 1)
+		time.Sleep(5 * time.Millisecond)
+		if n > 1 {
+			refreshed <- struct{}{}
+		}
+		return loaderUser{Name: key, Age: int(n)}, nil
+	}
+	loader, err := NewLoader[loaderUser](hc, load, LoaderOption[loaderUser]{
+		TTL:              time.Minute,
+		EarlyRefreshBeta: 1e9,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	user, err := loader.Get(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, user.Age)
+
+	// the stale value is returned while it is refreshed in the background
+	user, err = loader.Get(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, user.Age)
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("value not refreshed")
+	}
+	require.Eventually(t, func() bool { return mr.HGet("test:alice", "age") == "2" }, time.Second, 10*time.Millisecond)
+}
+
+func TestLoaderWrite(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	load := func(ctx context.Context, key string) (loaderUser, error) { return loaderUser{}, ErrNotFound }
+	var source sync.Map
+	written := make(chan string, 1)
+	writeErr := errors.New("read only")
+
+	through, err := NewLoader[loaderUser](hc, load, LoaderOption[loaderUser]{
+		WriteThrough: func(ctx context.Context, key string, value loaderUser) error {
+			if key == "readonly" {
+				return writeErr
+			}
+			source.Store(key, value)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, through.Set(ctx, "alice", loaderUser{Name: "alice"}))
+	_, ok := source.Load("alice")
+	require.True(t, ok)
+	user, err := through.Get(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, "alice", user.Name)
+
+	require.Equal(t, writeErr, through.Set(ctx, "readonly", loaderUser{Name: "bob"}))
+	require.False(t, mr.Exists("test:readonly"))
+
+	errs := make(chan error, 1)
+	behind, err := NewLoader[loaderUser](hc, load, LoaderOption[loaderUser]{
+		WriteBehind: func(ctx context.Context, key string, value loaderUser) error {
+			written <- key
+			return writeErr
+		},
+		OnError: func(key string, err error) { errs <- err },
+	})
+	require.NoError(t, err)
+	require.NoError(t, behind.Set(ctx, "carol", loaderUser{Name: "carol"}))
+	require.Equal(t, "carol", mr.HGet("test:carol", "name"))
+	require.Equal(t, "carol", <-written)
+	require.Equal(t, writeErr, <-errs)
+
+	_, err = NewLoader[loaderUser](nil, load, LoaderOption[loaderUser]{})
+	require.Equal(t, ErrUnsupportedCache, err)
+}
+
+func TestLoaderSetDuringLoad(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context, key string) (loaderUser, error) {
+		close(started)
+		<-release
+		return loaderUser{Name: "stale"}, nil
+	}
+	loader, err := NewLoader[loaderUser](hc, load, LoaderOption[loaderUser]{EarlyRefreshBeta: -1})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loader.Get(ctx, "alice")
+	}()
+	<-started
+	require.NoError(t, loader.Set(ctx, "alice", loaderUser{Name: "fresh"}))
+	close(release)
+	<-done
+
+	user, err := loader.Get(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, "fresh", user.Name)
+}
+
+func TestLoaderWriteBehindOrder(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	var running, overlaps int32
+	var mu sync.Mutex
+	var last int
+	load := func(ctx context.Context, key string) (loaderUser, error) { return loaderUser{}, ErrNotFound }
+	loader, err := NewLoader[loaderUser](hc, load, LoaderOption[loaderUser]{
+		WriteBehind: func(ctx context.Context, key string, value loaderUser) error {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			last = value.Age
+			mu.Unlock()
+			atomic.AddInt32(&running, -1)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 1; i <= 20; i++ {
+		require.NoError(t, loader.Set(ctx, "alice", loaderUser{Name: "alice", Age: i}))
+	}
+	require.Eventually(t, func() bool {
+		loader.writesMu.Lock()
+		defer loader.writesMu.Unlock()
+		return len(loader.writes) == 0
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, int32(0), atomic.LoadInt32(&overlaps))
+	mu.Lock()
+	require.Equal(t, 20, last)
+	mu.Unlock()
+}
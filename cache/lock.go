@@ -0,0 +1,328 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// DefaultLockTTL is the default lease of the locks
+	DefaultLockTTL = 30 * time.Second
+	// DefaultLockRetryMin is the default first wait between attempts of Locker.Lock
+	DefaultLockRetryMin = 50 * time.Millisecond
+	// DefaultLockRetryMax is the default longest wait between attempts of Locker.Lock
+	DefaultLockRetryMax = time.Second
+	// lockDriftFactor is the share of the ttl removed from the validity of the
+	// locks for the clock drift between the instances
+	lockDriftFactor = 0.01
+)
+
+var (
+	// ErrNotObtained is returned when the lock is held by another owner
+	ErrNotObtained = errors.New("cache: lock not obtained")
+	// ErrLockNotHeld is returned when extending or releasing a lock which expired
+	// or is held by another owner
+	ErrLockNotHeld = errors.New("cache: lock not held")
+)
+
+// acquireScript sets the owner token ARGV[1] of the lock KEYS[1] for ARGV[2] ms when it is free.
+// It returns the incremented fencing counter KEYS[2], or 0 when the lock is held.
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// extendScript sets the ttl of the lock KEYS[1] to ARGV[2] ms when its owner is ARGV[1]
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock KEYS[1] when its owner is ARGV[1]
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// raiseFenceScript raises the fencing counter KEYS[1] to ARGV[1]
+var raiseFenceScript = redis.NewScript(`
+local fence = tonumber(redis.call('GET', KEYS[1]) or '0')
+if fence < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// LockOption configures a Locker, zero fields use their default
+type LockOption struct {
+	// TTL is the lease of the locks, DefaultLockTTL when zero
+	TTL time.Duration
+	// RetryMin is the first wait between attempts of Lock, doubled after every attempt
+	// up to RetryMax, DefaultLockRetryMin when zero
+	RetryMin time.Duration
+	// RetryMax is the longest wait between attempts of Lock, DefaultLockRetryMax when zero
+	RetryMax time.Duration
+}
+
+// Locker obtains locks from one redis, or from a majority of independent redis instances
+// with the Redlock algorithm. A lock is owned by a random token, only its owner can extend
+// or release it. Every lock comes with a fencing token, greater than the tokens of the
+// previous locks of the same name, for the resources to reject writes of stale owners.
+type Locker struct {
+	clients []redis.Cmdable
+	prefix  string
+	option  LockOption
+}
+
+// NewLocker returns locker keeping its locks in the redis of hc, a HashCache made by this
+// package, under the prefix of hc
+func NewLocker(hc HashCache, option LockOption) (*Locker, error) {
+	commander, ok := hc.(hashCommander)
+	if !ok {
+		return nil, ErrUnsupportedCache
+	}
+	prefix := commander.realKey("")
+	return newLocker(prefix[:len(prefix)-1], []redis.Cmdable{commander.cmdable()}, option), nil
+}
+
+// NewRedlock returns locker obtaining its locks from a majority of clients, each one
+// connected to an independent redis instance. Their clocks must advance at the same rate.
+func NewRedlock(prefix string, clients []redis.Cmdable, option LockOption) (*Locker, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("cache: redlock without clients")
+	}
+	return newLocker(prefix, clients, option), nil
+}
+
+func newLocker(prefix string, clients []redis.Cmdable, option LockOption) *Locker {
+	if option.TTL == 0 {
+		option.TTL = DefaultLockTTL
+	}
+	if option.RetryMin == 0 {
+		option.RetryMin = DefaultLockRetryMin
+	}
+	if option.RetryMax == 0 {
+		option.RetryMax = DefaultLockRetryMax
+	}
+	return &Locker{clients: clients, prefix: prefix, option: option}
+}
+
+// Lock is a lock obtained by Locker
+type Lock struct {
+	locker *Locker
+	name   string
+	token  string
+	fence  int64
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// Name returns the name of the lock
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token returns the owner token of the lock
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Fence returns the fencing token of the lock, send it with the writes protected by the lock
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// ValidUntil returns the time the lock can be considered held until, unless extended
+func (l *Lock) ValidUntil() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.until
+}
+
+// Extend extends the lease of the lock to ttl, or to the TTL of the locker when zero.
+// It returns ErrLockNotHeld when the lock was lost.
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = l.locker.option.TTL
+	}
+	start := time.Now()
+	n, err := l.locker.eval(ctx, extendScript, l.keys()[:1], l.token, milliseconds(ttl))
+	if until, ok := l.locker.valid(start, ttl, n); ok {
+		l.mu.Lock()
+		l.until = until
+		l.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+// Release releases the lock. It returns ErrLockNotHeld when the lock was already lost.
+func (l *Lock) Release(ctx context.Context) error {
+	n, err := l.locker.eval(context.WithoutCancel(ctx), releaseScript, l.keys()[:1], l.token)
+	if n > 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+func (l *Lock) keys() []string {
+	return l.locker.keys(l.name)
+}
+
+// keys returns the lock and fencing counter keys of name,
+// the hash tag keeps both keys in the same cluster slot
+func (lk *Locker) keys(name string) []string {
+	key := fmt.Sprintf("%s:{%s}", lk.prefix, name)
+	return []string{key, key + ":fence"}
+}
+
+// quorum is the number of instances granting a lock
+func (lk *Locker) quorum() int {
+	return len(lk.clients)/2 + 1
+}
+
+// valid returns the validity of a lock granted by n instances for ttl from start
+func (lk *Locker) valid(start time.Time, ttl time.Duration, n int) (time.Time, bool) {
+	drift := time.Duration(float64(ttl)*lockDriftFactor) + 2*time.Millisecond
+	until := start.Add(ttl - drift)
+	return until, n >= lk.quorum() && time.Now().Before(until)
+}
+
+// eval runs script on every instance and returns the number of instances
+// whose result is not 0, with the errors of the others
+func (lk *Locker) eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (int, error) {
+	results, err := evalAll(ctx, lk.clients, script, keys, args...)
+	n := 0
+	for _, res := range results {
+		if res != 0 {
+			n++
+		}
+	}
+	return n, err
+}
+
+// evalAll runs script on clients concurrently, commands are not abandoned when ctx is done
+// so that no lock is left behind
+func evalAll(ctx context.Context, clients []redis.Cmdable, script *redis.Script, keys []string, args ...interface{}) ([]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	results := make([]int64, len(clients))
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client redis.Cmdable) {
+			defer wg.Done()
+			results[i], errs[i] = script.Run(client, keys, args...).Int64()
+		}(i, client)
+	}
+	wg.Wait()
+	return results, errors.Join(errs...)
+}
+
+// TryLock obtains the lock name once. It returns ErrNotObtained when it is held by another owner.
+func (lk *Locker) TryLock(ctx context.Context, name string) (*Lock, error) {
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+	keys := lk.keys(name)
+	ttl := lk.option.TTL
+
+	start := time.Now()
+	fences, err := evalAll(ctx, lk.clients, acquireScript, keys, token, milliseconds(ttl))
+	if fences == nil {
+		return nil, err
+	}
+	var fence int64
+	var granted []redis.Cmdable
+	for i, f := range fences {
+		if f != 0 {
+			granted = append(granted, lk.clients[i])
+		}
+		if f > fence {
+			fence = f
+		}
+	}
+	until, ok := lk.valid(start, ttl, len(granted))
+	if ok && len(lk.clients) > 1 {
+		// every granting instance keeps the fencing token, the majority of the next lock
+		// includes one of them so its token is greater
+		if _, err = evalAll(ctx, granted, raiseFenceScript, keys[1:], fence); err != nil {
+			ok = false
+		}
+	}
+	if !ok {
+		if len(granted) > 0 {
+			evalAll(context.WithoutCancel(ctx), granted, releaseScript, keys[:1], token)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, cerr
+		}
+		return nil, ErrNotObtained
+	}
+	return &Lock{locker: lk, name: name, token: token, fence: fence, until: until}, nil
+}
+
+// Lock obtains the lock name, waiting with exponential backoff while it is held by
+// another owner or redis fails, until ctx is done
+func (lk *Locker) Lock(ctx context.Context, name string) (*Lock, error) {
+	wait := lk.option.RetryMin
+	for {
+		lock, err := lk.TryLock(ctx, name)
+		if err == nil {
+			return lock, nil
+		}
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, cerr
+		}
+		// jitter avoids the owners waiting on the same lock to retry together
+		timer := time.NewTimer(wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if wait *= 2; wait > lk.option.RetryMax {
+			wait = lk.option.RetryMax
+		}
+	}
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
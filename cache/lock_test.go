@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocker(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	locker, err := NewLocker(hc, LockOption{TTL: time.Second, RetryMin: 10 * time.Millisecond, RetryMax: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	lock, err := locker.TryLock(ctx, "job")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), lock.Fence())
+	require.Equal(t, lock.Token(), mustGet(t, mr, "test:{job}"))
+	require.True(t, lock.ValidUntil().After(time.Now()))
+
+	_, err = locker.TryLock(ctx, "job")
+	require.Equal(t, ErrNotObtained, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(timeout, "job")
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, lock.Extend(ctx, 5*time.Second))
+	require.Equal(t, 5*time.Second, mr.TTL("test:{job}"))
+
+	// the lock expires and is taken by another owner
+	mr.FastForward(5 * time.Second)
+	other, err := locker.TryLock(ctx, "job")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), other.Fence())
+	require.Equal(t, ErrLockNotHeld, lock.Extend(ctx, 0))
+	require.Equal(t, ErrLockNotHeld, lock.Release(ctx))
+	require.Equal(t, other.Token(), mustGet(t, mr, "test:{job}"))
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		other.Release(ctx)
+		close(released)
+	}()
+	next, err := locker.Lock(ctx, "job")
+	require.NoError(t, err)
+	<-released
+	require.Equal(t, int64(3), next.Fence())
+	require.NoError(t, next.Release(ctx))
+	require.False(t, mr.Exists("test:{job}"))
+
+	_, err = NewLocker(nil, LockOption{})
+	require.Equal(t, ErrUnsupportedCache, err)
+}
+
+func TestRedlock(t *testing.T) {
+	var instances []*miniredis.Miniredis
+	var clients []redis.Cmdable
+	for i := 0; i < 3; i++ {
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+		instances = append(instances, mr)
+		clients = append(clients, client)
+	}
+	locker, err := NewRedlock("test", clients, LockOption{TTL: time.Second})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	// an instance had more locks than the others, the fencing token keeps increasing
+	instances[0].Set("test:{job}:fence", "10")
+	lock, err := locker.TryLock(ctx, "job")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), lock.Fence())
+	for _, mr := range instances {
+		require.Equal(t, "11", mustGet(t, mr, "test:{job}:fence"))
+	}
+
+	// a minority holds the lock of another owner
+	require.NoError(t, lock.Release(ctx))
+	instances[1].Set("test:{job}", "other")
+	instances[2].Set("test:{job}", "other")
+	_, err = locker.TryLock(ctx, "job")
+	require.Equal(t, ErrNotObtained, err)
+	require.False(t, instances[0].Exists("test:{job}"))
+	instances[2].Del("test:{job}")
+
+	// a majority is enough
+	instances[1].Close()
+	lock, err = locker.TryLock(ctx, "job")
+	require.NoError(t, err)
+	require.Greater(t, lock.Fence(), int64(11))
+	require.NoError(t, lock.Extend(ctx, 0))
+	require.NoError(t, lock.Release(ctx))
+
+	instances[2].Close()
+	_, err = locker.TryLock(ctx, "job")
+	require.Error(t, err)
+	require.NotEqual(t, ErrNotObtained, err)
+	require.False(t, instances[0].Exists("test:{job}"))
+}
+
+func mustGet(t *testing.T, mr *miniredis.Miniredis, key string) string {
+	t.Helper()
+	value, err := mr.Get(key)
+	require.NoError(t, err)
+	return value
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruEntry is a hash stored by lru
+type lruEntry struct {
+	key     string
+	values  map[string]string
+	size    int64
+	expires time.Time
+}
+
+// lru is an in memory least recently used cache of hashes, bounded by entries and bytes,
+// its entries expire after ttl
+type lru struct {
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	bytes      int64
+	evictions  uint64
+	now        func() time.Time
+
+	// fills counts the fills of the keys being read from the HashCache,
+	// generations count the removals of these keys while they are filled
+	fills       map[string]int
+	generations map[string]uint64
+}
+
+func newLRU(maxEntries int, maxBytes int64, ttl time.Duration) *lru {
+	return &lru{
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		now:        time.Now,
+
+		fills:       make(map[string]int),
+		generations: make(map[string]uint64),
+	}
+}
+
+// hashSize approximates the memory used by the hash of key
+func hashSize(key string, values map[string]string) int64 {
+	size := int64(len(key))
+	for f, v := range values {
+		size += int64(len(f) + len(v))
+	}
+	return size
+}
+
+// get returns the hash of key, values must not be modified
+func (c *lru) get(key string) (map[string]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if !c.now().Before(e.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.values, true
+}
+
+// beginFill returns the generation of key before reading its hash,
+// addIfGeneration must be called once the hash is read
+func (c *lru) beginFill(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fills[key]++
+	return c.generations[key]
+}
+
+// addIfGeneration ends the fill of key started by beginFill, storing values as its
+// hash unless key was removed since generation or values is nil
+func (c *lru) addIfGeneration(key string, values map[string]string, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current := c.generations[key]
+	if c.fills[key]--; c.fills[key] <= 0 {
+		delete(c.fills, key)
+		delete(c.generations, key)
+	}
+	if values != nil && current == generation {
+		c.addLocked(key, values)
+	}
+}
+
+// add stores values as the hash of key, hashes larger than maxBytes are not stored
+func (c *lru) add(key string, values map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addLocked(key, values)
+}
+
+func (c *lru) addLocked(key string, values map[string]string) {
+	size := hashSize(key, values)
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	e := &lruEntry{key: key, values: values, size: size, expires: c.now().Add(c.ttl)}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += size
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+// remove removes keys, it reports whether one of them was stored
+func (c *lru) remove(keys ...string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := false
+	for _, key := range keys {
+		if _, ok := c.fills[key]; ok {
+			c.generations[key]++
+		}
+		if el, ok := c.items[key]; ok {
+			c.removeElement(el)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// purge removes all the entries
+func (c *lru) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+	for key := range c.fills {
+		c.generations[key]++
+	}
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*lruEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+// stats returns the entries, bytes and evictions of the cache
+func (c *lru) stats() (entries int, bytes int64, evictions uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len(), c.bytes, c.evictions
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+)
+
+// DefaultRedisPort is the port of the addresses given without port
+const DefaultRedisPort = "6379"
+
+// RedisOption configures the redis clients of the caches, zero fields use the go-redis defaults
+type RedisOption struct {
+	// Addrs are the addresses of the standalone redis, of the sentinels with MasterName,
+	// or the seed nodes of the cluster with Cluster or more than one address
+	Addrs []string
+	// MasterName is the name of the master monitored by the sentinels
+	MasterName string
+	// Cluster connects to a redis cluster, even with one seed address.
+	// Keys and ScanKeys of a HashCache only see the keys of one node of a cluster.
+	Cluster bool
+	// Password authenticates the connections
+	Password string
+	// DB is the database index, ignored by clusters
+	DB int
+	// TLS connects with TLS when set, e.g. with grcp.CertProvider.ClientTLSConfig()
+	TLS *tls.Config
+
+	// PoolSize is the number of connections per node
+	PoolSize int
+	// MinIdleConns is the number of idle connections kept per node
+	MinIdleConns int
+	// MaxRetries is the number of retries of failed commands, -1 disables them
+	MaxRetries   int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// PoolTimeout is the wait for a connection when all of them are busy
+	PoolTimeout time.Duration
+	// IdleTimeout closes the connections idle for longer
+	IdleTimeout time.Duration
+}
+
+// NewRedisClient returns client of the standalone redis, the sentinel master or the cluster of option
+func NewRedisClient(option RedisOption) redis.UniversalClient {
+	opts := &redis.UniversalOptions{
+		Addrs:        option.Addrs,
+		MasterName:   option.MasterName,
+		Password:     option.Password,
+		DB:           option.DB,
+		TLSConfig:    option.TLS,
+		PoolSize:     option.PoolSize,
+		MinIdleConns: option.MinIdleConns,
+		MaxRetries:   option.MaxRetries,
+		DialTimeout:  option.DialTimeout,
+		ReadTimeout:  option.ReadTimeout,
+		WriteTimeout: option.WriteTimeout,
+		PoolTimeout:  option.PoolTimeout,
+		IdleTimeout:  option.IdleTimeout,
+	}
+	if option.Cluster && option.MasterName == "" && len(option.Addrs) == 1 {
+		// the universal client only makes a cluster client for several addresses
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        opts.Addrs,
+			Password:     opts.Password,
+			TLSConfig:    opts.TLSConfig,
+			PoolSize:     opts.PoolSize,
+			MinIdleConns: opts.MinIdleConns,
+			MaxRetries:   opts.MaxRetries,
+			DialTimeout:  opts.DialTimeout,
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+			PoolTimeout:  opts.PoolTimeout,
+			IdleTimeout:  opts.IdleTimeout,
+		})
+	}
+	return redis.NewUniversalClient(opts)
+}
+
+// NewRedisHashCacheWithOption returns new redis hash cache connected with option
+func NewRedisHashCacheWithOption(prefix string, option RedisOption) HashCache {
+	return NewSharedHashCache(NewRedisClient(option), true, prefix)
+}
+
+// NewRedisPubSubWithOption returns new redis publish subcriber connected with option
+func NewRedisPubSubWithOption(prefix string, option RedisOption) PubSubRedis {
+	return &redisPubSub{client: NewRedisClient(option), prefix: prefix}
+}
+
+// ConfigRedisOption returns defaults overridden by the config.AppConfig keys config.RDhost,
+// a comma separated list of addresses completed by config.RDport, config.RDpassword,
+// config.RDmaster, config.RDcluster, config.RDdb, config.RDtls and config.RDpoolsize.
+// With TLS the servers are verified with config.CAcert when set, unless defaults has RootCAs.
+func ConfigRedisOption(defaults RedisOption) (RedisOption, error) {
+	option := defaults
+	port := strings.TrimSpace(cfg.Get(cfg.RDport, ""))
+	if port == "" {
+		port = DefaultRedisPort
+	}
+	if hosts := cfg.Get(cfg.RDhost, ""); hosts != "" {
+		option.Addrs = nil
+		for _, host := range strings.Split(hosts, ",") {
+			if host = strings.TrimSpace(host); host == "" {
+				continue
+			}
+			if _, _, err := net.SplitHostPort(host); err != nil {
+				host = net.JoinHostPort(host, port)
+			}
+			option.Addrs = append(option.Addrs, host)
+		}
+	}
+	if v := cfg.Get(cfg.RDpassword, ""); v != "" {
+		option.Password = v
+	}
+	if v := cfg.Get(cfg.RDmaster, ""); v != "" {
+		option.MasterName = v
+	}
+	if v, err := strconv.ParseBool(cfg.Get(cfg.RDcluster, "")); err == nil {
+		option.Cluster = v
+	}
+	if v, err := strconv.Atoi(cfg.Get(cfg.RDdb, "")); err == nil {
+		option.DB = v
+	}
+	if v, err := strconv.Atoi(cfg.Get(cfg.RDpoolsize, "")); err == nil {
+		option.PoolSize = v
+	}
+	if v, err := strconv.ParseBool(cfg.Get(cfg.RDtls, "")); err == nil {
+		if !v {
+			option.TLS = nil
+		} else if option.TLS == nil {
+			option.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+	}
+	if option.TLS != nil && option.TLS.RootCAs == nil {
+		if ca := cfg.Get(cfg.CAcert, ""); ca != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(ca)) {
+				return option, errors.New("cache: invalid CAcert")
+			}
+			option.TLS = option.TLS.Clone()
+			option.TLS.RootCAs = pool
+		}
+	}
+	if len(option.Addrs) == 0 {
+		return option, errors.New("cache: no redis address")
+	}
+	return option, nil
+}
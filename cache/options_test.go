@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+)
+
+func TestRedisOption(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+
+	hc := NewRedisHashCacheWithOption("test", RedisOption{Addrs: []string{mr.Addr()}, Password: "secret", DB: 2, PoolSize: 2})
+	defer hc.Close()
+	require.NoError(t, hc.MSet("alice", map[string]interface{}{"name": "alice"}))
+	mr.Select(2)
+	require.Equal(t, "alice", mr.HGet("test:alice", "name"))
+
+	denied := NewRedisHashCacheWithOption("test", RedisOption{Addrs: []string{mr.Addr()}})
+	defer denied.Close()
+	require.Error(t, denied.(Pinger).Ping())
+
+	ps := NewRedisPubSubWithOption("test", RedisOption{Addrs: []string{mr.Addr()}, Password: "secret"})
+	defer ps.Close()
+	require.NoError(t, ps.(Pinger).Ping())
+
+	cluster := NewRedisClient(RedisOption{Addrs: []string{mr.Addr()}, Cluster: true})
+	defer cluster.Close()
+	require.IsType(t, &redis.ClusterClient{}, cluster)
+	sentinel := NewRedisClient(RedisOption{Addrs: []string{mr.Addr()}, MasterName: "master"})
+	defer sentinel.Close()
+	require.IsType(t, &redis.Client{}, sentinel)
+}
+
+func TestConfigRedisOption(t *testing.T) {
+	saved := cfg.AppConfig.ConfigData
+	defer func() { cfg.AppConfig.ConfigData = saved }()
+
+	cfg.AppConfig.ConfigData = map[string]string{}
+	_, err := ConfigRedisOption(RedisOption{})
+	require.Error(t, err)
+
+	option, err := ConfigRedisOption(RedisOption{Addrs: []string{"localhost:6379"}, PoolSize: 5})
+	require.NoError(t, err)
+	require.Equal(t, RedisOption{Addrs: []string{"localhost:6379"}, PoolSize: 5}, option)
+
+	cfg.AppConfig.ConfigData = map[string]string{
+		cfg.RDhost:     "redis-1, redis-2:7000,",
+		cfg.RDport:     "6380",
+		cfg.RDpassword: "secret",
+		cfg.RDcluster:  "true",
+		cfg.RDdb:       "1",
+		cfg.RDpoolsize: "20",
+		cfg.RDtls:      "true",
+	}
+	option, err = ConfigRedisOption(RedisOption{PoolSize: 5})
+	require.NoError(t, err)
+	require.Equal(t, []string{"redis-1:6380", "redis-2:7000"}, option.Addrs)
+	require.Equal(t, "secret", option.Password)
+	require.True(t, option.Cluster)
+	require.Equal(t, 1, option.DB)
+	require.Equal(t, 20, option.PoolSize)
+	require.NotNil(t, option.TLS)
+	require.Equal(t, uint16(tls.VersionTLS12), option.TLS.MinVersion)
+	require.Nil(t, option.TLS.RootCAs)
+
+	cfg.AppConfig.ConfigData[cfg.CAcert] = "not a certificate"
+	_, err = ConfigRedisOption(RedisOption{})
+	require.Error(t, err)
+
+	cfg.AppConfig.ConfigData[cfg.RDtls] = "false"
+	option, err = ConfigRedisOption(RedisOption{TLS: &tls.Config{}})
+	require.NoError(t, err)
+	require.Nil(t, option.TLS)
+}
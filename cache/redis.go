@@ -17,7 +17,7 @@ const (
 )
 
 type redisHashCache struct {
-	client      *redis.Client
+	client      redis.UniversalClient
 	closeClient bool
 	prefix      string
 }
@@ -39,8 +39,8 @@ func NewRedisSentinelHashCache(master, prefix string, sentinels []string) HashCa
 		prefix:      prefix}
 }
 
-// NewSharedHashCache return new shared redis hash cache
-func NewSharedHashCache(cli *redis.Client, closeClient bool, prefix string) HashCache {
+// NewSharedHashCache return new shared redis hash cache, cli can be made by NewRedisClient
+func NewSharedHashCache(cli redis.UniversalClient, closeClient bool, prefix string) HashCache {
 	return &redisHashCache{
 		client:      cli,
 		closeClient: closeClient,
@@ -234,6 +234,31 @@ func (rhc *redisHashCache) Close() error {
 	return nil
 }
 
+// Ping checks the connection to redis
+func (rhc *redisHashCache) Ping() error {
+	return rhc.client.Ping().Err()
+}
+
+// realKey returns the redis key of key
+func (rhc *redisHashCache) realKey(key string) string {
+	return fmt.Sprintf("%s:%s", rhc.prefix, key)
+}
+
+// cmdable returns the redis client of the cache
+func (rhc *redisHashCache) cmdable() redis.Cmdable {
+	return rhc.client
+}
+
+// RedisClient returns the redis client of hc, a HashCache made by this package,
+// e.g. to share its connections with ratelimit
+func RedisClient(hc HashCache) (redis.Cmdable, error) {
+	commander, ok := hc.(hashCommander)
+	if !ok {
+		return nil, ErrUnsupportedCache
+	}
+	return commander.cmdable(), nil
+}
+
 // ScanKeys is scan all keys with count (default is 100).
 // this will return list of keys and error
 func (rhc *redisHashCache) ScanKeys() ([]string, error) {
@@ -401,7 +426,7 @@ func (rhc *redisHashCache) HmsetPipeline(pipe redis.Pipeliner, params KeyMapValu
 }
 
 type redisPubSub struct {
-	client *redis.Client
+	client redis.UniversalClient
 	prefix string
 }
 
@@ -442,6 +467,11 @@ func (rps *redisPubSub) ClosePubSub(red *redis.PubSub) error {
 	return red.Close()
 }
 
+// Ping checks the connection to redis
+func (rps *redisPubSub) Ping() error {
+	return rps.client.Ping().Err()
+}
+
 func (rps *redisPubSub) Close() error {
 	return rps.client.Close()
 }
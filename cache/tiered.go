@@ -0,0 +1,337 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// DefaultLocalMaxEntries is the default number of hashes kept in process
+	DefaultLocalMaxEntries = 10000
+	// DefaultLocalMaxBytes is the default size of the hashes kept in process
+	DefaultLocalMaxBytes = 64 << 20
+	// DefaultLocalTTL is the default ttl of the hashes kept in process
+	DefaultLocalTTL = time.Minute
+	// DefaultInvalidationTopic is the default pub/sub topic of the invalidations
+	DefaultInvalidationTopic = "cache-invalidation"
+)
+
+// TieredOption configures a TieredHashCache, zero fields use their default
+type TieredOption struct {
+	// MaxEntries is the number of hashes kept in process, DefaultLocalMaxEntries when zero
+	MaxEntries int
+	// MaxBytes bounds the size of the keys, fields and values kept in process, DefaultLocalMaxBytes when zero
+	MaxBytes int64
+	// TTL of the hashes kept in process, DefaultLocalTTL when zero. It bounds how long a
+	// replica serves a stale hash when an invalidation is lost.
+	TTL time.Duration
+	// Topic of the invalidations, DefaultInvalidationTopic when empty
+	Topic string
+	// OnError is called with the errors of publishing and receiving invalidations
+	OnError func(err error)
+}
+
+// TierStats counts the lookups of a tier
+type TierStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// TieredStats are the stats of a TieredHashCache
+type TieredStats struct {
+	// Local counts the lookups of the in process cache
+	Local TierStats
+	// Remote counts the lookups of the HashCache made on local misses
+	Remote TierStats
+	// Entries, Bytes and Evictions describe the in process cache
+	Entries   int
+	Bytes     int64
+	Evictions uint64
+	// Invalidations counts the invalidations received from the replicas
+	Invalidations uint64
+}
+
+type tierCounter struct {
+	hits   uint64
+	misses uint64
+}
+
+func (c *tierCounter) count(hit bool) {
+	if hit {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+func (c *tierCounter) stats() TierStats {
+	return TierStats{Hits: atomic.LoadUint64(&c.hits), Misses: atomic.LoadUint64(&c.misses)}
+}
+
+// TieredHashCache keeps the hashes read by MGet and Get in process in front of a HashCache.
+// Its writes and deletes publish the keys through PubSubRedis so every replica evicts them.
+// Writes made with the pipelines of the HashCache are not seen, their hashes stay
+// in process until TTL.
+type TieredHashCache struct {
+	HashCache
+	ps      PubSubRedis
+	sub     *redis.PubSub
+	topic   string
+	onError func(error)
+	local   *lru
+
+	invalidations uint64
+	localStats    tierCounter
+	remoteStats   tierCounter
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTieredHashCache returns hc with an in process cache in front of it. The invalidations
+// are published and received through ps, with a nil ps they only evict the local copy.
+func NewTieredHashCache(hc HashCache, ps PubSubRedis, option TieredOption) (*TieredHashCache, error) {
+	if option.MaxEntries == 0 {
+		option.MaxEntries = DefaultLocalMaxEntries
+	}
+	if option.MaxBytes == 0 {
+		option.MaxBytes = DefaultLocalMaxBytes
+	}
+	if option.TTL == 0 {
+		option.TTL = DefaultLocalTTL
+	}
+	if option.Topic == "" {
+		option.Topic = DefaultInvalidationTopic
+	}
+	if option.OnError == nil {
+		option.OnError = func(error) {}
+	}
+	c := &TieredHashCache{
+		HashCache: hc,
+		ps:        ps,
+		topic:     option.Topic,
+		onError:   option.OnError,
+		local:     newLRU(option.MaxEntries, option.MaxBytes, option.TTL),
+		done:      make(chan struct{}),
+	}
+	if ps == nil {
+		close(c.done)
+		return c, nil
+	}
+
+	c.sub = ps.SubscribePubSub(option.Topic)
+	// wait for the subscription, invalidations published before are lost
+	if _, err := c.sub.Receive(); err != nil {
+		ps.ClosePubSub(c.sub)
+		return nil, err
+	}
+	go c.receive(ps.Channel(c.sub))
+	return c, nil
+}
+
+func (c *TieredHashCache) receive(messages <-chan *redis.Message) {
+	defer close(c.done)
+	for msg := range messages {
+		var keys []string
+		if err := json.Unmarshal([]byte(msg.Payload), &keys); err != nil {
+			c.onError(err)
+			continue
+		}
+		atomic.AddUint64(&c.invalidations, 1)
+		c.evict(keys...)
+	}
+}
+
+// evict removes keys from the in process cache, the hashes of keys being
+// read from the HashCache are not kept
+func (c *TieredHashCache) evict(keys ...string) {
+	c.local.remove(keys...)
+}
+
+// invalidate evicts keys and publishes them to the replicas
+func (c *TieredHashCache) invalidate(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	c.evict(keys...)
+	if c.ps == nil {
+		return
+	}
+	payload, err := json.Marshal(keys)
+	if err == nil {
+		err = c.ps.Publish(c.topic, string(payload))
+	}
+	if err != nil {
+		c.onError(err)
+	}
+}
+
+// MGet returns the hash of key from the in process cache, or from the HashCache when missing.
+// Empty hashes are not kept in process.
+func (c *TieredHashCache) MGet(key string) (map[string]string, error) {
+	if values, ok := c.local.get(key); ok {
+		c.localStats.count(true)
+		return copyHash(values), nil
+	}
+	c.localStats.count(false)
+
+	generation := c.local.beginFill(key)
+	values, err := c.HashCache.MGet(key)
+	if err != nil || len(values) == 0 {
+		c.local.addIfGeneration(key, nil, generation)
+		if err == nil {
+			c.remoteStats.count(false)
+		}
+		return values, err
+	}
+	c.remoteStats.count(true)
+	c.local.addIfGeneration(key, copyHash(values), generation)
+	return values, nil
+}
+
+// Get returns field of the hash of key, from the in process cache when it has the hash
+func (c *TieredHashCache) Get(key, field string) (string, error) {
+	if values, ok := c.local.get(key); ok {
+		c.localStats.count(true)
+		value, ok := values[field]
+		if !ok {
+			return "", redis.Nil
+		}
+		return value, nil
+	}
+	c.localStats.count(false)
+	value, err := c.HashCache.Get(key, field)
+	if err == nil || err == redis.Nil {
+		c.remoteStats.count(err == nil)
+	}
+	return value, err
+}
+
+// MSet sets fields of the hash of key and invalidates it
+func (c *TieredHashCache) MSet(key string, values map[string]interface{}) error {
+	defer c.invalidate(key)
+	return c.HashCache.MSet(key, values)
+}
+
+// BatchMSet sets the hashes like HashCache.BatchMSet and invalidates them
+func (c *TieredHashCache) BatchMSet(values []map[string]interface{}) error {
+	var keys []string
+	for _, v := range values {
+		if key, ok := v[Key]; ok {
+			keys = append(keys, keyString(key))
+		}
+	}
+	defer c.invalidate(keys...)
+	return c.HashCache.BatchMSet(values)
+}
+
+// Set sets field of the hash of key and invalidates it
+func (c *TieredHashCache) Set(key, field, value string) error {
+	defer c.invalidate(key)
+	return c.HashCache.Set(key, field, value)
+}
+
+// Hincrby increments field of the hash of key and invalidates it
+func (c *TieredHashCache) Hincrby(key, field string, incre int64) error {
+	defer c.invalidate(key)
+	return c.HashCache.Hincrby(key, field, incre)
+}
+
+// Del deletes the hash of key and invalidates it
+func (c *TieredHashCache) Del(key string) error {
+	defer c.invalidate(key)
+	return c.HashCache.Del(key)
+}
+
+// Dels deletes the hashes of keys and invalidates them
+func (c *TieredHashCache) Dels(keys ...string) error {
+	defer c.invalidate(keys...)
+	return c.HashCache.Dels(keys...)
+}
+
+// BatchMDel deletes the hashes of keys and invalidates them
+func (c *TieredHashCache) BatchMDel(keys ...string) error {
+	defer c.invalidate(keys...)
+	return c.HashCache.BatchMDel(keys...)
+}
+
+// Expire sets the ttl of the hash of key and invalidates it
+func (c *TieredHashCache) Expire(key string, ttl time.Duration) error {
+	defer c.invalidate(key)
+	return c.HashCache.Expire(key, ttl)
+}
+
+// Expireat sets the expiry of the hash of key and invalidates it
+func (c *TieredHashCache) Expireat(key string, at time.Time) error {
+	defer c.invalidate(key)
+	return c.HashCache.Expireat(key, at)
+}
+
+// ClearSetNX deletes key and invalidates it
+func (c *TieredHashCache) ClearSetNX(key string) error {
+	defer c.invalidate(key)
+	return c.HashCache.ClearSetNX(key)
+}
+
+// Invalidate evicts keys from the in process cache of every replica,
+// e.g. after writing them with a pipeline
+func (c *TieredHashCache) Invalidate(keys ...string) {
+	c.invalidate(keys...)
+}
+
+// Purge removes all the hashes kept in process by this replica
+func (c *TieredHashCache) Purge() {
+	c.local.purge()
+}
+
+// Stats returns the stats of the tiers
+func (c *TieredHashCache) Stats() TieredStats {
+	entries, bytes, evictions := c.local.stats()
+	return TieredStats{
+		Local:         c.localStats.stats(),
+		Remote:        c.remoteStats.stats(),
+		Entries:       entries,
+		Bytes:         bytes,
+		Evictions:     evictions,
+		Invalidations: atomic.LoadUint64(&c.invalidations),
+	}
+}
+
+// Ping checks the connection of the HashCache when it is a Pinger
+func (c *TieredHashCache) Ping() error {
+	if p, ok := c.HashCache.(Pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// Close stops receiving invalidations and closes the HashCache, ps is left open
+func (c *TieredHashCache) Close() error {
+	c.closeOnce.Do(func() {
+		if c.sub != nil {
+			if err := c.ps.ClosePubSub(c.sub); err != nil {
+				c.onError(err)
+			}
+		}
+		<-c.done
+	})
+	return c.HashCache.Close()
+}
+
+func copyHash(values map[string]string) map[string]string {
+	cp := make(map[string]string, len(values))
+	for k, v := range values {
+		cp[k] = v
+	}
+	return cp
+}
+
+// keyString formats key like the real keys of HashCache.BatchMSet
+func keyString(key interface{}) string {
+	return fmt.Sprint(key)
+}
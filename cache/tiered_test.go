@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredHashCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ps := NewRedisPubSub(mr.Addr(), "test")
+	defer ps.Close()
+
+	replica1, err := NewTieredHashCache(NewRedisHashCache(mr.Addr(), "test"), ps, TieredOption{})
+	require.NoError(t, err)
+	defer replica1.Close()
+	replica2, err := NewTieredHashCache(NewRedisHashCache(mr.Addr(), "test"), ps, TieredOption{})
+	require.NoError(t, err)
+	defer replica2.Close()
+
+	require.NoError(t, replica1.MSet("alice", map[string]interface{}{"name": "alice"}))
+	require.Eventually(t, func() bool { return replica2.Stats().Invalidations == 1 }, time.Second, 5*time.Millisecond)
+	for _, c := range []*TieredHashCache{replica1, replica2} {
+		values, err := c.MGet("alice")
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"name": "alice"}, values)
+		values["name"] = "changed"
+	}
+
+	// served in process, redis is not read
+	mr.HSet("test:alice", "name", "stale")
+	values, err := replica2.MGet("alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"name": "alice"}, values)
+	name, err := replica2.Get("alice", "name")
+	require.NoError(t, err)
+	require.Equal(t, "alice", name)
+	_, err = replica2.Get("alice", "age")
+	require.Equal(t, redis.Nil, err)
+
+	require.NoError(t, replica1.Set("alice", "name", "alicia"))
+	require.Eventually(t, func() bool { return replica2.Stats().Invalidations >= 2 }, time.Second, 5*time.Millisecond)
+	name, err = replica2.Get("alice", "name")
+	require.NoError(t, err)
+	require.Equal(t, "alicia", name)
+	values, err = replica2.MGet("alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"name": "alicia"}, values)
+
+	require.NoError(t, replica1.Del("alice"))
+	require.Eventually(t, func() bool { return replica2.Stats().Invalidations >= 3 }, time.Second, 5*time.Millisecond)
+	values, err = replica2.MGet("alice")
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	stats := replica2.Stats()
+	require.Equal(t, TierStats{Hits: 3, Misses: 4}, stats.Local)
+	require.Equal(t, TierStats{Hits: 3, Misses: 1}, stats.Remote)
+	require.Equal(t, 0, stats.Entries)
+}
+
+func TestTieredHashCacheBounds(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := NewTieredHashCache(NewRedisHashCache(mr.Addr(), "test"), nil, TieredOption{MaxEntries: 2, MaxBytes: 20, TTL: time.Minute})
+	require.NoError(t, err)
+	defer c.Close()
+
+	now := time.Now()
+	c.local.now = func() time.Time { return now }
+	for _, key := range []string{"a", "b", "c"} {
+		mr.HSet("test:"+key, "f", "v")
+		_, err := c.MGet(key)
+		require.NoError(t, err)
+	}
+	stats := c.Stats()
+	require.Equal(t, 2, stats.Entries)
+	require.Equal(t, int64(6), stats.Bytes)
+	require.Equal(t, uint64(1), stats.Evictions)
+
+	// larger than MaxBytes, not kept
+	mr.HSet("test:big", "field", "a value larger than the cache")
+	_, err = c.MGet("big")
+	require.NoError(t, err)
+	require.Equal(t, 2, c.Stats().Entries)
+
+	now = now.Add(time.Minute)
+	_, err = c.MGet("c")
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), c.Stats().Local.Hits)
+
+	require.NoError(t, c.BatchMSet([]map[string]interface{}{{Key: "c", "f": "w"}}))
+	require.Equal(t, 1, c.Stats().Entries)
+	c.Purge()
+	require.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestTieredHashCacheFill(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := NewTieredHashCache(NewRedisHashCache(mr.Addr(), "test"), nil, TieredOption{})
+	require.NoError(t, err)
+	defer c.Close()
+
+	// removing another key does not drop the fill of a
+	generation := c.local.beginFill("a")
+	c.local.remove("b")
+	c.local.addIfGeneration("a", map[string]string{"f": "v"}, generation)
+	require.Equal(t, 1, c.Stats().Entries)
+
+	// c removed while it is filled is not kept
+	generation = c.local.beginFill("c")
+	c.evict("c")
+	c.local.addIfGeneration("c", map[string]string{"f": "v"}, generation)
+	require.Equal(t, 1, c.Stats().Entries)
+	require.Empty(t, c.local.fills)
+	require.Empty(t, c.local.generations)
+
+	require.NoError(t, c.Expire("a", time.Minute))
+	require.Equal(t, 0, c.Stats().Entries)
+
+	mr.HSet("test:1", "f", "v")
+	_, err = c.MGet("1")
+	require.NoError(t, err)
+	require.NoError(t, c.Expireat("1", time.Now().Add(time.Minute)))
+	require.Equal(t, 0, c.Stats().Entries)
+
+	_, err = c.MGet("1")
+	require.NoError(t, err)
+	require.NoError(t, c.BatchMSet([]map[string]interface{}{{Key: 1, "f": "w"}}))
+	require.Equal(t, 0, c.Stats().Entries)
+	values, err := c.MGet("1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"f": "w"}, values)
+}
@@ -0,0 +1,425 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/uuid"
+)
+
+// TagName is the struct tag mapping fields to hash fields, e.g.
+//
+//	type User struct {
+//		ID        uuid.UUID `cache:"user_id_msb,user_id_lsb"`
+//		Name      string    `cache:"name,omitempty"`
+//		Active    bool      `cache:"active"`
+//		CreatedAt time.Time `cache:"created_at"`
+//		Secret    string    `cache:"-"`
+//	}
+//
+// uuid.UUID fields are stored as their MSB and LSB, named by the tag or the name
+// followed by "_msb" and "_lsb". time.Time fields are stored as unix seconds, bools
+// as 1 or 0. Zero values of omitempty fields are not stored. Untagged fields use
+// their name and the fields of embedded structs are flattened.
+const TagName = "cache"
+
+// ErrUnsupportedCache is returned for typed caches over a HashCache not made by this package
+var ErrUnsupportedCache = errors.New("cache: hash cache does not support typed access")
+
+// ErrWritePending is returned with ctx.Err() when ctx is done after a write was sent,
+// the write was not abandoned and may still be applied
+var ErrWritePending = errors.New("cache: write may still complete")
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// hashCommander is implemented by the redis HashCache
+type hashCommander interface {
+	realKey(key string) string
+	cmdable() redis.Cmdable
+}
+
+type hashField struct {
+	index     []int
+	names     []string
+	omitEmpty bool
+}
+
+// hashCodec maps the fields of a struct type to hash fields
+type hashCodec struct {
+	fields []hashField
+}
+
+func newHashCodec(typ reflect.Type) (*hashCodec, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cache: %s is not a struct", typ)
+	}
+	c := &hashCodec{}
+	if err := c.addFields(typ, nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *hashCodec) addFields(typ reflect.Type, index []int) error {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag, tagged := sf.Tag.Lookup(TagName)
+		if tag == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+		// the exported fields of embedded structs are promoted, even when the struct is not exported
+		if sf.Anonymous && !tagged && sf.Type.Kind() == reflect.Struct && sf.Type != uuidType && sf.Type != timeType {
+			if err := c.addFields(sf.Type, fieldIndex); err != nil {
+				return err
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if !supportedHashType(sf.Type) {
+			return fmt.Errorf("cache: unsupported type %s of field %s", sf.Type, sf.Name)
+		}
+
+		f := hashField{index: fieldIndex}
+		for _, part := range strings.Split(tag, ",") {
+			switch part = strings.TrimSpace(part); part {
+			case "":
+			case "omitempty":
+				f.omitEmpty = true
+			default:
+				f.names = append(f.names, part)
+			}
+		}
+		if len(f.names) == 0 {
+			f.names = []string{sf.Name}
+		}
+		if sf.Type == uuidType && len(f.names) == 1 {
+			f.names = []string{f.names[0] + "_msb", f.names[0] + "_lsb"}
+		}
+		if (sf.Type == uuidType) != (len(f.names) == 2) || len(f.names) > 2 {
+			return fmt.Errorf("cache: invalid tag %q of field %s", tag, sf.Name)
+		}
+		c.fields = append(c.fields, f)
+	}
+	return nil
+}
+
+func supportedHashType(typ reflect.Type) bool {
+	if typ == uuidType || typ == timeType {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return typ.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+func isEmptyHashValue(v reflect.Value) bool {
+	switch v.Type() {
+	case uuidType:
+		return v.Interface().(uuid.UUID).IsEmpty()
+	case timeType:
+		return v.Interface().(time.Time).Unix() <= 0
+	}
+	return v.IsZero()
+}
+
+// encode returns the hash fields of the struct v
+func (c *hashCodec) encode(v reflect.Value) map[string]interface{} {
+	values := make(map[string]interface{}, len(c.fields))
+	for _, f := range c.fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isEmptyHashValue(fv) {
+			continue
+		}
+		switch fv.Type() {
+		case uuidType:
+			id := fv.Interface().(uuid.UUID)
+			values[f.names[0]] = strconv.FormatUint(id.MSB, 10)
+			values[f.names[1]] = strconv.FormatUint(id.LSB, 10)
+			continue
+		case timeType:
+			t := fv.Interface().(time.Time)
+			if t.IsZero() {
+				values[f.names[0]] = "0"
+			} else {
+				values[f.names[0]] = strconv.FormatInt(t.Unix(), 10)
+			}
+			continue
+		}
+		var s string
+		switch fv.Kind() {
+		case reflect.String:
+			s = fv.String()
+		case reflect.Bool:
+			s = "0"
+			if fv.Bool() {
+				s = "1"
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s = strconv.FormatInt(fv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s = strconv.FormatUint(fv.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			s = strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits())
+		case reflect.Slice:
+			s = string(fv.Bytes())
+		}
+		values[f.names[0]] = s
+	}
+	return values
+}
+
+// decode sets the fields of the struct v from the hash fields of values,
+// fields missing from values are left as is
+func (c *hashCodec) decode(values map[string]string, v reflect.Value) error {
+	for _, f := range c.fields {
+		fv := v.FieldByIndex(f.index)
+		s, ok := values[f.names[0]]
+		if !ok {
+			continue
+		}
+		var err error
+		switch fv.Type() {
+		case uuidType:
+			var msb, lsb uint64
+			if msb, err = strconv.ParseUint(s, 10, 64); err == nil {
+				lsb, err = strconv.ParseUint(values[f.names[1]], 10, 64)
+			}
+			if err == nil {
+				fv.Set(reflect.ValueOf(uuid.FromInt(msb, lsb)))
+			}
+		case timeType:
+			var sec int64
+			if sec, err = strconv.ParseInt(s, 10, 64); err == nil {
+				t := time.Time{}
+				if sec != 0 {
+					t = time.Unix(sec, 0)
+				}
+				fv.Set(reflect.ValueOf(t))
+			}
+		default:
+			err = decodeHashValue(s, fv)
+		}
+		if err != nil {
+			return fmt.Errorf("cache: invalid value %q of field %s: %w", s, f.names[0], err)
+		}
+	}
+	return nil
+}
+
+func decodeHashValue(s string, fv reflect.Value) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	case reflect.Slice:
+		fv.SetBytes([]byte(s))
+	}
+	return nil
+}
+
+// withContext runs fn until ctx is done. go-redis can not cancel a sent command,
+// when ctx is done first ctx.Err() is returned and the command completes in the background.
+func withContext(ctx context.Context, fn func() error) error {
+	_, err := runContext(ctx, fn)
+	return err
+}
+
+// writeWithContext is withContext for writes, ctx.Err() is joined to ErrWritePending
+// when ctx is done after the write was sent
+func writeWithContext(ctx context.Context, fn func() error) error {
+	sent, err := runContext(ctx, fn)
+	if sent && err != nil && err == ctx.Err() {
+		return fmt.Errorf("%w: %w", ErrWritePending, err)
+	}
+	return err
+}
+
+// runContext runs fn until ctx is done, sent reports whether fn was started
+func runContext(ctx context.Context, fn func() error) (sent bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if ctx.Done() == nil {
+		return true, fn()
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- fn() }()
+	select {
+	case err := <-errc:
+		return true, err
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
+
+// TypedHashCache stores structs of type T in the hashes of a HashCache
+type TypedHashCache[T any] struct {
+	hc    hashCommander
+	codec *hashCodec
+}
+
+// NewTypedHashCache returns typed cache over hc, a HashCache made by this package.
+// T must be a struct type whose fields are mapped by TagName.
+func NewTypedHashCache[T any](hc HashCache) (*TypedHashCache[T], error) {
+	commander, ok := hc.(hashCommander)
+	if !ok {
+		return nil, ErrUnsupportedCache
+	}
+	codec, err := newHashCodec(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return &TypedHashCache[T]{hc: commander, codec: codec}, nil
+}
+
+// Encode returns the hash fields of value, e.g. for HashCache.MSet
+func (c *TypedHashCache[T]) Encode(value T) map[string]interface{} {
+	return c.codec.encode(reflect.ValueOf(value))
+}
+
+// Decode returns the value of the hash fields values, e.g. from HashCache.MGet
+func (c *TypedHashCache[T]) Decode(values map[string]string) (T, error) {
+	var value T
+	err := c.codec.decode(values, reflect.ValueOf(&value).Elem())
+	return value, err
+}
+
+// Get returns the value of key, redis.Nil when key does not exist
+func (c *TypedHashCache[T]) Get(ctx context.Context, key string) (T, error) {
+	var values map[string]string
+	err := withContext(ctx, func() (err error) {
+		values, err = c.hc.cmdable().HGetAll(c.hc.realKey(key)).Result()
+		return err
+	})
+	if err == nil && len(values) == 0 {
+		err = redis.Nil
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.Decode(values)
+}
+
+// Set replaces the hash of key by value, it expires after ttl unless ttl is zero.
+// When ctx is done first ErrWritePending is returned, the write may still be applied.
+func (c *TypedHashCache[T]) Set(ctx context.Context, key string, value T, ttl time.Duration) error {
+	return c.MSet(ctx, map[string]T{key: value}, ttl)
+}
+
+// MGet returns the values of the existing keys
+func (c *TypedHashCache[T]) MGet(ctx context.Context, keys ...string) (map[string]T, error) {
+	cmds := make([]*redis.StringStringMapCmd, len(keys))
+	err := withContext(ctx, func() error {
+		pipe := c.hc.cmdable().Pipeline()
+		defer pipe.Close()
+		for i, key := range keys {
+			cmds[i] = pipe.HGetAll(c.hc.realKey(key))
+		}
+		_, err := pipe.Exec()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]T, len(keys))
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := c.Decode(fields)
+		if err != nil {
+			return nil, err
+		}
+		values[keys[i]] = value
+	}
+	return values, nil
+}
+
+// MSet replaces the hashes of the keys of values in one transaction, they expire after
+// ttl unless ttl is zero. On a redis cluster the transaction is split by go-redis into
+// one transaction per slot, keys of different slots are not written atomically.
+// When ctx is done first ErrWritePending is returned, the transaction may still be committed.
+func (c *TypedHashCache[T]) MSet(ctx context.Context, values map[string]T, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return writeWithContext(ctx, func() error {
+		pipe := c.hc.cmdable().TxPipeline()
+		defer pipe.Close()
+		for key, value := range values {
+			realKey := c.hc.realKey(key)
+			pipe.Del(realKey)
+			fields := c.Encode(value)
+			if len(fields) == 0 {
+				continue
+			}
+			pipe.HMSet(realKey, fields)
+			if ttl > 0 {
+				pipe.Expire(realKey, ttl)
+			}
+		}
+		_, err := pipe.Exec()
+		return err
+	})
+}
+
+// Del deletes keys, on a redis cluster they must be in the same slot.
+// When ctx is done first ErrWritePending is returned, the keys may still be deleted.
+func (c *TypedHashCache[T]) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	realKeys := make([]string, len(keys))
+	for i, key := range keys {
+		realKeys[i] = c.hc.realKey(key)
+	}
+	return writeWithContext(ctx, func() error {
+		return c.hc.cmdable().Del(realKeys...).Err()
+	})
+}
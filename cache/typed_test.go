@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/uuid"
+)
+
+type typedAudit struct {
+	CreatedAt time.Time `cache:"created_at"`
+	Version   int32     `cache:"version,omitempty"`
+}
+
+type typedUser struct {
+	typedAudit
+	ID      uuid.UUID `cache:"user_id_msb,user_id_lsb"`
+	OrgID   uuid.UUID `cache:"org_id,omitempty"`
+	Name    string    `cache:"name"`
+	Active  bool      `cache:"active"`
+	Balance float64   `cache:"balance"`
+	Avatar  []byte    `cache:"avatar,omitempty"`
+	Secret  string    `cache:"-"`
+}
+
+func TestTypedHashCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	users, err := NewTypedHashCache[typedUser](hc)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	user := typedUser{
+		typedAudit: typedAudit{CreatedAt: time.Unix(1700000000, 0)},
+		ID:         uuid.FromInt(1, 2),
+		Name:       "alice",
+		Active:     true,
+		Balance:    12.5,
+		Secret:     "s",
+	}
+	require.Equal(t, map[string]interface{}{
+		"created_at":  "1700000000",
+		"user_id_msb": "1",
+		"user_id_lsb": "2",
+		"name":        "alice",
+		"active":      "1",
+		"balance":     "12.5",
+	}, users.Encode(user))
+
+	require.NoError(t, users.Set(ctx, "alice", user, time.Minute))
+	require.Equal(t, time.Minute, mr.TTL("test:alice"))
+	require.Equal(t, "alice", mr.HGet("test:alice", "name"))
+
+	got, err := users.Get(ctx, "alice")
+	require.NoError(t, err)
+	user.Secret = ""
+	require.Equal(t, user.ID, got.ID)
+	require.True(t, user.CreatedAt.Equal(got.CreatedAt))
+	got.CreatedAt = user.CreatedAt
+	require.Equal(t, user, got)
+
+	_, err = users.Get(ctx, "bob")
+	require.Equal(t, redis.Nil, err)
+
+	bob := typedUser{ID: uuid.FromInt(3, 4), OrgID: uuid.FromInt(5, 6), Name: "bob"}
+	require.NoError(t, users.MSet(ctx, map[string]typedUser{"bob": bob}, 0))
+	require.Equal(t, "5", mr.HGet("test:bob", "org_id_msb"))
+	values, err := users.MGet(ctx, "alice", "bob", "carol")
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	require.Equal(t, bob, values["bob"])
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = users.Get(canceled, "alice")
+	require.Equal(t, context.Canceled, err)
+	// not sent
+	require.Equal(t, context.Canceled, users.Set(canceled, "alice", bob, 0))
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = writeWithContext(timeout, func() error {
+		<-blocked
+		return nil
+	})
+	require.ErrorIs(t, err, ErrWritePending)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, users.Del(ctx, "alice", "bob"))
+	require.False(t, mr.Exists("test:alice"))
+
+	type invalid struct {
+		Tags []string `cache:"tags"`
+	}
+	_, err = NewTypedHashCache[invalid](hc)
+	require.Error(t, err)
+}
@@ -41,6 +41,7 @@ type ServerCommandConf struct {
 	PreparedIP        string
 	TLS               credentials.TransportCredentials
 	SSLCertificate    ssl.Certificate
+	CertProvider      *run.CertProvider
 	ReadTimeout       time.Duration
 	ReadHeaderTimeout time.Duration
 	WriteTimeout      time.Duration
@@ -130,25 +131,25 @@ func (scc *ServerCommandConf) NilSafeDeregister() {
 	}
 }
 
-// PrepareTLSAndSSL prepare TLS and SSLCertificate for service server
+// PrepareTLSAndSSL prepare TLS and SSLCertificate for service server,
+// the certificate files are watched and reloaded by CertProvider
 func (scc *ServerCommandConf) PrepareTLSAndSSL() {
-	var sslCert ssl.Certificate
-	var tls credentials.TransportCredentials
-	if len(scc.CAPath) > 0 && len(scc.CertPath) > 0 && len(scc.PrivateKey) > 0 {
-		var err error
-		sslCert, err = ssl.LoadX509KeyPair(scc.CertPath, scc.PrivateKey)
-		if err != nil {
-			scc.Logger.Log(log.LogError, err.Error())
-			return
-		}
-		tls, err = run.TLSCredentialFromKeyPair(scc.CAPath, sslCert, true)
-		if err != nil {
-			scc.Logger.Log(log.LogError, err.Error())
-			return
-		}
+	if len(scc.CAPath) == 0 || len(scc.CertPath) == 0 || len(scc.PrivateKey) == 0 {
+		return
+	}
+	provider, err := run.NewFileCertProvider(scc.CAPath, scc.CertPath, scc.PrivateKey, scc.Logger)
+	if err != nil {
+		scc.Logger.Log(log.LogError, err.Error())
+		return
 	}
-	scc.SSLCertificate = sslCert
-	scc.TLS = tls
+	sslCert, err := provider.Certificate()
+	if err != nil {
+		scc.Logger.Log(log.LogError, err.Error())
+		return
+	}
+	scc.CertProvider = provider
+	scc.SSLCertificate = *sslCert
+	scc.TLS = provider.ServerCredentials(true)
 }
 
 // ListenAndServe server with commons uninus configuration
@@ -162,32 +163,33 @@ func (scc *ServerCommandConf) ListenAndServe() error {
 			Certificates: []ssl.Certificate{scc.SSLCertificate},
 		},
 	}
+	if scc.CertProvider != nil {
+		server.TLSConfig = scc.CertProvider.ServerTLSConfig(false)
+	}
 	return server.ListenAndServe()
 }
 
 // DefaultHTTPHandlerWithAllowedOrigin enables cross-origin resource sharing
+// for the configured allowed origins, overridable by cors keys of the app config
 func (scc *ServerCommandConf) defaultHTTPHandlerWithAllowedOrigin(handler http.Handler) http.Handler {
+	var origins []string
+	for _, origin := range strings.Split(scc.AllowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	handler = run.CORSMiddlewareFromConfig(run.AllowedOriginsCORSPolicy(origins...))(handler)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// logging origin
 		scc.Logger.Log(log.LogInfo, fmt.Sprintf("%+v accessor", r.Header.Get("Origin")))
-
-		w.Header().Set("Access-Control-Allow-Origin", scc.AllowedOrigins)
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
-			headers := []string{"Content-Type", "Accept", "Authorization"}
-			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ","))
-			methods := []string{"GET", "HEAD", "POST", "PUT", "DELETE"}
-			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ","))
-			w.Header().Set("Access-Control-Max-Age", "86400")
-			return
-		}
 		handler.ServeHTTP(w, r)
 	})
 }
 
 // DefaultHTTPHandler specifies default http handler
 func (scc *ServerCommandConf) DefaultHTTPHandler(handler http.Handler) http.Handler {
-	handler = run.LogRequestHandler(handler)
+	handler = run.PayloadLogMiddleware(run.ConfigPayloadLogger(scc.Logger))(handler)
 	handler = handlers.CompressHandler(handler)
 	handler = scc.defaultHTTPHandlerWithAllowedOrigin(handler)
 	handler = run.HealthCheckHandler(handler)
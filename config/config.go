@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/uninus-opensource/uninus-go-architect-common/flags"
 	"github.com/uninus-opensource/uninus-go-architect-common/config/configetcd"
@@ -21,6 +22,10 @@ type StdConfig struct {
 	ConfigData  map[string]string
 	EventPath   string
 	eventHook   func()
+	eventHooks  []func()
+	hooksMu     sync.Mutex
+	// dataMu guards ConfigData against Get and the change events
+	dataMu sync.RWMutex
 }
 
 const (
@@ -42,6 +47,16 @@ const (
 	RDhost     = "rdhost"
 	RDport     = "rdport"
 	RDpassword = "rdpassword"
+	// RDmaster is the sentinel master name, RDhost are then the sentinel addresses
+	RDmaster = "rdmaster"
+	// RDcluster connects to a redis cluster seeded by RDhost
+	RDcluster = "rdcluster"
+	// RDdb is the database index, ignored by clusters
+	RDdb = "rddb"
+	// RDtls connects with TLS, verified with CAcert when set
+	RDtls = "rdtls"
+	// RDpoolsize is the number of connections per redis node
+	RDpoolsize = "rdpoolsize"
 
 	GProjectId = "gprojectid"
 	GCredFile  = "gcredfile"
@@ -50,6 +65,21 @@ const (
 
 	Addr_listen = "addr_listen"
 	Addr_debug  = "addr_debug"
+
+	CORSAllowedOrigins        = "cors_allowed_origins"
+	CORSAllowedOriginPatterns = "cors_allowed_origin_patterns"
+	CORSAllowedMethods        = "cors_allowed_methods"
+	CORSAllowedHeaders        = "cors_allowed_headers"
+	CORSExposedHeaders        = "cors_exposed_headers"
+	CORSAllowCredentials      = "cors_allow_credentials"
+	CORSMaxAge                = "cors_max_age"
+
+	// MTLSAllowlist is a json object of grpc methods or http paths to the peer identities allowed to call them
+	MTLSAllowlist = "mtls_allowlist"
+	// GRPCMaxDeadlines is a json object of grpc methods or http paths to their max deadline, e.g. "5s"
+	GRPCMaxDeadlines = "grpc_max_deadlines"
+	// PayloadLogging is a json object of the payload logging policy of grpc and http calls
+	PayloadLogging = "payload_logging"
 )
 
 var ValidKeys = map[string]bool{
@@ -77,10 +107,14 @@ func Get(key string, defval string) string {
 
 	//find the key in the current defval map
 	//
+	AppConfig.dataMu.RLock()
 	v, ok := AppConfig.ConfigData[key]
+	AppConfig.dataMu.RUnlock()
 	if !ok {
 		if defval != "" {
+			AppConfig.dataMu.Lock()
 			AppConfig.ConfigData[key] = defval
+			AppConfig.dataMu.Unlock()
 			v = defval
 		}
 	}
@@ -148,6 +182,38 @@ func (sc *StdConfig) SetChangeNotificationFunc(f func()) {
 	sc.eventHook = f
 }
 
+// AddChangeNotificationFunc adds f to the functions called on config change,
+// next to the one set by SetChangeNotificationFunc
+func (sc *StdConfig) AddChangeNotificationFunc(f func()) {
+	sc.hooksMu.Lock()
+	defer sc.hooksMu.Unlock()
+	sc.eventHooks = append(sc.eventHooks, f)
+}
+
+// Snapshot returns a copy of ConfigData, safe to read while the config changes
+func (sc *StdConfig) Snapshot() map[string]string {
+	sc.dataMu.RLock()
+	defer sc.dataMu.RUnlock()
+	data := make(map[string]string, len(sc.ConfigData))
+	for k, v := range sc.ConfigData {
+		data[k] = v
+	}
+	return data
+}
+
+func (sc *StdConfig) notifyChange() {
+	if sc.eventHook != nil {
+		sc.eventHook()
+	}
+	// the hooks are called without the lock, they may add hooks
+	sc.hooksMu.Lock()
+	hooks := append([]func(){}, sc.eventHooks...)
+	sc.hooksMu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
 // loads a standard config file,
 // located in the same path as the app,
 // containing only servicename and confighosts array
@@ -279,17 +345,17 @@ func (sc *StdConfig) LoadConfig() bool {
 }
 
 func (sc *StdConfig) onZKChangeEvent(nodename string, dataMap configzk.ConfigFormat) {
+	sc.dataMu.Lock()
 	sc.ConfigData = dataMap
 	sc.EventPath = nodename
-	if sc.eventHook != nil {
-		sc.eventHook()
-	}
+	sc.dataMu.Unlock()
+	sc.notifyChange()
 }
 
 func (sc *StdConfig) onETCDChangeEvent(nodename string, dataMap configetcd.ConfigFormat) {
+	sc.dataMu.Lock()
 	sc.ConfigData = dataMap
 	sc.EventPath = nodename
-	if sc.eventHook != nil {
-		sc.eventHook()
-	}
+	sc.dataMu.Unlock()
+	sc.notifyChange()
 }
@@ -0,0 +1,167 @@
+package errors
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// AppError is an application error sent to clients as grpc status details
+type AppError struct {
+	// Code is the grpc status code
+	Code codes.Code
+	// AppCode is the application error code, sent as ErrorInfo reason
+	AppCode string
+	// Message is the grpc status message
+	Message string
+	// Domain is the ErrorInfo domain, usually the service name
+	Domain string
+	// Metadata is additional ErrorInfo data
+	Metadata map[string]string
+	// Fields are the invalid request fields, sent as BadRequest
+	Fields []FieldViolation
+	// RetryDelay tells clients when to retry, sent as RetryInfo
+	RetryDelay time.Duration
+	// Localized are messages for the end user, sent as LocalizedMessage
+	Localized []LocalizedMessage
+}
+
+// FieldViolation describes an invalid request field
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// LocalizedMessage is a message in the given locale, e.g. "id-ID"
+type LocalizedMessage struct {
+	Locale  string
+	Message string
+}
+
+// NewAppError returns new application error
+func NewAppError(code codes.Code, appCode, message string) *AppError {
+	return &AppError{Code: code, AppCode: appCode, Message: message}
+}
+
+// WithDomain sets the domain of the error
+func (e *AppError) WithDomain(domain string) *AppError {
+	e.Domain = domain
+	return e
+}
+
+// WithMetadata adds key value to the error metadata
+func (e *AppError) WithMetadata(key, value string) *AppError {
+	if e.Metadata == nil {
+		e.Metadata = make(map[string]string)
+	}
+	e.Metadata[key] = value
+	return e
+}
+
+// WithField adds an invalid request field
+func (e *AppError) WithField(field, description string) *AppError {
+	e.Fields = append(e.Fields, FieldViolation{Field: field, Description: description})
+	return e
+}
+
+// WithRetryDelay sets when clients may retry the call
+func (e *AppError) WithRetryDelay(delay time.Duration) *AppError {
+	e.RetryDelay = delay
+	return e
+}
+
+// WithLocalizedMessage adds a message for the end user in locale
+func (e *AppError) WithLocalizedMessage(locale, message string) *AppError {
+	e.Localized = append(e.Localized, LocalizedMessage{Locale: locale, Message: message})
+	return e
+}
+
+func (e *AppError) Error() string {
+	if e.AppCode == "" {
+		return e.Message
+	}
+	return e.AppCode + ": " + e.Message
+}
+
+// GRPCStatus returns the error as grpc status with details,
+// it lets grpc servers send AppError returned by endpoints as is
+func (e *AppError) GRPCStatus() *status.Status {
+	s := status.New(e.Code, e.Message)
+
+	var details []protoadapt.MessageV1
+	if e.AppCode != "" || e.Domain != "" || len(e.Metadata) > 0 {
+		details = append(details, &errdetails.ErrorInfo{Reason: e.AppCode, Domain: e.Domain, Metadata: e.Metadata})
+	}
+	if len(e.Fields) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, f := range e.Fields {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Description})
+		}
+		details = append(details, br)
+	}
+	if e.RetryDelay > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(e.RetryDelay)})
+	}
+	for _, l := range e.Localized {
+		details = append(details, &errdetails.LocalizedMessage{Locale: l.Locale, Message: l.Message})
+	}
+
+	if withDetails, err := s.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return s
+}
+
+// FromStatus decodes the application error sent in s
+func FromStatus(s *status.Status) *AppError {
+	e := &AppError{Code: s.Code(), Message: s.Message()}
+	for _, detail := range s.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			e.AppCode = d.GetReason()
+			e.Domain = d.GetDomain()
+			e.Metadata = d.GetMetadata()
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				e.Fields = append(e.Fields, FieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		case *errdetails.RetryInfo:
+			e.RetryDelay = d.GetRetryDelay().AsDuration()
+		case *errdetails.LocalizedMessage:
+			e.Localized = append(e.Localized, LocalizedMessage{Locale: d.GetLocale(), Message: d.GetMessage()})
+		}
+	}
+	return e
+}
+
+// FromError returns the application error in err, which can be an AppError
+// or an error returned by a grpc client. It returns false for other errors.
+func FromError(err error) (*AppError, bool) {
+	if err == nil {
+		return nil, false
+	}
+
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+	return FromStatus(s), true
+}
+
+// AppCode returns the application error code of err, empty if it has none
+func AppCode(err error) string {
+	if e, ok := FromError(err); ok {
+		return e.AppCode
+	}
+	return ""
+}
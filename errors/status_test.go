@@ -0,0 +1,34 @@
+package errors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAppErrorStatus(t *testing.T) {
+	appErr := NewAppError(codes.InvalidArgument, "INVALID_STUDENT", "invalid student").
+		WithDomain("student").
+		WithMetadata("nim", "41037006").
+		WithField("email", "email is required").
+		WithRetryDelay(2*time.Second).
+		WithLocalizedMessage("id-ID", "data mahasiswa tidak valid")
+
+	// what a grpc client receives
+	err := status.ErrorProto(appErr.GRPCStatus().Proto())
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	decoded, ok := FromError(err)
+	require.True(t, ok)
+	require.Equal(t, appErr, decoded)
+	require.Equal(t, "INVALID_STUDENT", AppCode(err))
+	require.Equal(t, "INVALID_STUDENT", AppCode(fmt.Errorf("get student: %w", appErr)))
+
+	_, ok = FromError(fmt.Errorf("boom"))
+	require.False(t, ok)
+	require.Equal(t, "", AppCode(status.Error(codes.Internal, "boom")))
+}
@@ -11,7 +11,7 @@ const ETCD_GLOBALS_CONFIG_PATH = "/globals/"
 const ZK_GLOBALS_CONFIG_PATH = "/globals"
 
 //monitor Prometheus
-// const UNINUS_PROMETHEUS_NAMESPACE = "UninusService"
+const UNINUS_PROMETHEUS_NAMESPACE = "UninusService"
 // const UNINUS_PROMETHEUS_SWITCH_COUNTER_ON = "Counter"
 // const UNINUS_PROMETHEUS_SWITCH_Histogram_ON = "Histogram"
 // const UNINUS_PROMETHEUS_SWITCH_ALL_ON = "Enable"
@@ -0,0 +1,198 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/sony/gobreaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ulog "github.com/uninus-opensource/uninus-go-architect-common/log"
+)
+
+// BreakerScope is what a circuit breaker of a client connection guards
+type BreakerScope int
+
+const (
+	// BreakerPerInstance opens the circuit of every method of a failing instance
+	BreakerPerInstance BreakerScope = iota
+	// BreakerPerMethod opens the circuit of the failing method of an instance only
+	BreakerPerMethod
+)
+
+// defaultBreakerLogger logs the state changes of the breakers made with DefaultCBSetting
+var defaultBreakerLogger = ulog.StdLogger()
+
+// DefaultBreakerFailureCodes are the grpc codes counted as failures by circuit breakers,
+// other errors are the caller's fault and do not open the circuit
+var DefaultBreakerFailureCodes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.DataLoss}
+
+// CircuitBreakerOption configures the circuit breakers of client connections
+type CircuitBreakerOption struct {
+	Scope BreakerScope
+	// MaxRequests, Interval and Timeout are the gobreaker settings
+	MaxRequests uint32
+	Interval    time.Duration
+	Timeout     time.Duration
+	// the circuit opens when at least MinRequests were made in the interval
+	// and the ratio of failures is at least FailureRatio
+	MinRequests  uint32
+	FailureRatio float64
+	// FailureCodes are the grpc codes counted as failures
+	FailureCodes []codes.Code
+}
+
+// DefaultCircuitBreakerOption returns option opening the circuit of an instance
+// when 60% of at least 100 calls failed, like DefaultCBSetting
+func DefaultCircuitBreakerOption(timeout time.Duration) CircuitBreakerOption {
+	return CircuitBreakerOption{
+		Scope:        BreakerPerInstance,
+		MaxRequests:  10,
+		Interval:     2 * timeout,
+		Timeout:      timeout,
+		MinRequests:  100,
+		FailureRatio: 0.6,
+		FailureCodes: DefaultBreakerFailureCodes,
+	}
+}
+
+// ReadyToTrip reports whether counts should open the circuit
+func (o CircuitBreakerOption) ReadyToTrip(counts gobreaker.Counts) bool {
+	if counts.Requests == 0 || counts.Requests < o.MinRequests {
+		return false
+	}
+	return float64(counts.TotalFailures)/float64(counts.Requests) >= o.FailureRatio
+}
+
+// IsSuccessful reports whether err is not one of the failure codes
+func (o CircuitBreakerOption) IsSuccessful(err error) bool {
+	if err == nil {
+		return true
+	}
+	code := status.Code(err)
+	for _, c := range o.FailureCodes {
+		if c == code {
+			return false
+		}
+	}
+	return true
+}
+
+// Settings returns the gobreaker settings of the breaker named name,
+// state changes are logged with logger and exported as metrics
+func (o CircuitBreakerOption) Settings(name string, logger log.Logger) gobreaker.Settings {
+	return gobreaker.Settings{
+		Name:         name,
+		MaxRequests:  o.MaxRequests,
+		Interval:     o.Interval,
+		Timeout:      o.Timeout,
+		ReadyToTrip:  o.ReadyToTrip,
+		IsSuccessful: o.IsSuccessful,
+		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+			onCircuitBreakerStateChange(logger, name, from, to)
+		},
+	}
+}
+
+// onCircuitBreakerStateChange logs the state change with logger and exports it as metrics
+func onCircuitBreakerStateChange(logger log.Logger, name string, from gobreaker.State, to gobreaker.State) {
+	logger.Log("circuit_breaker", name, "from", from.String(), "to", to.String(), ulog.LogWarning, "circuit breaker state changed")
+	setCircuitBreakerState(name, to)
+}
+
+// breakerError is returned when the circuit is open, it is sent as Unavailable
+// and is not retried by RetryPolicy
+type breakerError struct {
+	err error
+}
+
+func (e *breakerError) Error() string { return e.err.Error() }
+
+func (e *breakerError) Unwrap() error { return e.err }
+
+func (e *breakerError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.err.Error())
+}
+
+// isBreakerOpen reports whether err is returned by an open circuit breaker
+func isBreakerOpen(err error) bool {
+	return errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests)
+}
+
+// circuitBreakers holds the breakers of a connection
+type circuitBreakers struct {
+	instance string
+	option   CircuitBreakerOption
+	logger   log.Logger
+
+	mu       sync.Mutex
+	breakers map[string]*gobreaker.CircuitBreaker
+}
+
+func newCircuitBreakers(instance string, option CircuitBreakerOption, logger log.Logger) *circuitBreakers {
+	return &circuitBreakers{
+		instance: instance,
+		option:   option,
+		logger:   logger,
+		breakers: make(map[string]*gobreaker.CircuitBreaker),
+	}
+}
+
+func (c *circuitBreakers) get(method string) *gobreaker.CircuitBreaker {
+	name := c.instance
+	if c.option.Scope == BreakerPerMethod {
+		name += method
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cb, ok := c.breakers[name]
+	if !ok {
+		cb = gobreaker.NewCircuitBreaker(c.option.Settings(name, c.logger))
+		c.breakers[name] = cb
+	}
+	return cb
+}
+
+func execute(cb *gobreaker.CircuitBreaker, call func() error) error {
+	_, err := cb.Execute(func() (interface{}, error) {
+		return nil, call()
+	})
+	if isBreakerOpen(err) {
+		return &breakerError{err: err}
+	}
+	return err
+}
+
+// UnaryClientCircuitBreakerInterceptor returns grpc client interceptor guarding
+// the calls to instance with circuit breakers configured by option
+func UnaryClientCircuitBreakerInterceptor(instance string, option CircuitBreakerOption, logger log.Logger) grpc.UnaryClientInterceptor {
+	return newCircuitBreakers(instance, option, logger).unary
+}
+
+// StreamClientCircuitBreakerInterceptor returns grpc client interceptor guarding
+// the streams opened to instance with circuit breakers configured by option
+func StreamClientCircuitBreakerInterceptor(instance string, option CircuitBreakerOption, logger log.Logger) grpc.StreamClientInterceptor {
+	return newCircuitBreakers(instance, option, logger).stream
+}
+
+func (c *circuitBreakers) unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return execute(c.get(method), func() error {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+}
+
+func (c *circuitBreakers) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	var stream grpc.ClientStream
+	err := execute(c.get(method), func() error {
+		var err error
+		stream, err = streamer(ctx, desc, cc, method, opts...)
+		return err
+	})
+	return stream, err
+}
@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreakerInterceptor(t *testing.T) {
+	option := DefaultCircuitBreakerOption(time.Minute)
+	option.Scope = BreakerPerMethod
+	option.MinRequests = 2
+	interceptor := UnaryClientCircuitBreakerInterceptor("localhost:9000", option, log.NewNopLogger())
+
+	calls := 0
+	fail := func(code codes.Code) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			return status.Error(code, code.String())
+		}
+	}
+
+	// invalid requests are not failures
+	interceptor(context.Background(), "/test.Service/A", nil, nil, nil, fail(codes.InvalidArgument))
+	for i := 0; i < 2; i++ {
+		interceptor(context.Background(), "/test.Service/A", nil, nil, nil, fail(codes.Unavailable))
+	}
+	require.Equal(t, 3, calls)
+	interceptor(context.Background(), "/test.Service/A", nil, nil, nil, fail(codes.Unavailable))
+	require.Equal(t, 3, calls)
+
+	for i := 0; i < 2; i++ {
+		interceptor(context.Background(), "/test.Service/B", nil, nil, nil, fail(codes.Unavailable))
+	}
+	require.Equal(t, 5, calls)
+
+	err := interceptor(context.Background(), "/test.Service/B", nil, nil, nil, fail(codes.Unavailable))
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.False(t, DefaultRetryPolicy().Retryable(err))
+	require.Equal(t, 5, calls)
+}
+
+func TestGrpcConnectionWithoutBreaker(t *testing.T) {
+	conn, err := GrpcConnection("localhost:1", nil, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = conn.Invoke(ctx, "/test.Service/A", nil, nil)
+	require.Error(t, err)
+
+	option := legacyClientOption(time.Second, 0)
+	require.NotNil(t, option.CircuitBreaker)
+	require.Equal(t, time.Duration(0), option.Timeout)
+}
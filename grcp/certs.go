@@ -0,0 +1,328 @@
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc/credentials"
+
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+	util "github.com/uninus-opensource/uninus-go-architect-common/log"
+)
+
+// certReloadDelay groups the file events of a rotation, e.g. cert and key written one after another
+const certReloadDelay = 100 * time.Millisecond
+
+// ErrNoCertificate is returned when the provider has no certificate loaded
+var ErrNoCertificate = errors.New("tls: no certificate loaded")
+
+// CertRotation is sent by CertProvider every time certificates are loaded
+type CertRotation struct {
+	Time time.Time
+	// Leaf is the loaded certificate, nil when loading failed
+	Leaf *x509.Certificate
+	// Err is the loading error, the previous certificates are kept in use
+	Err error
+}
+
+type certSource func() (caCert, cert, key []byte, err error)
+
+type certificates struct {
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// CertProvider serves certificates reloaded when their files or config change,
+// so certificates can be rotated without restarting the service
+type CertProvider struct {
+	source certSource
+	logger log.Logger
+
+	current atomic.Value
+	events  chan CertRotation
+
+	watcher   *fsnotify.Watcher
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newCertProvider(source certSource, logger log.Logger) (*CertProvider, error) {
+	p := &CertProvider{
+		source: source,
+		logger: logger,
+		events: make(chan CertRotation, 16),
+		done:   make(chan struct{}),
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewFileCertProvider returns provider loading the ca certificate, certificate and key files,
+// they are reloaded every time they change until Close is called
+func NewFileCertProvider(caFile, certFile, keyFile string, logger log.Logger) (*CertProvider, error) {
+	p, err := newCertProvider(func() ([]byte, []byte, []byte, error) {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cert, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return caCert, cert, key, nil
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	p.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// directories are watched as secrets are usually rotated by replacing the files
+	dirs := make(map[string]bool)
+	for _, file := range []string{caFile, certFile, keyFile} {
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := p.watcher.Add(dir); err != nil {
+			p.watcher.Close()
+			return nil, err
+		}
+	}
+	go p.watch()
+	return p, nil
+}
+
+// NewConfigCertProvider returns provider loading the certificates in PEM from
+// config.AppConfig keys config.CAcert, config.TLScrt and config.TLSkey,
+// they are reloaded every time the config changes
+func NewConfigCertProvider(logger log.Logger) (*CertProvider, error) {
+	p, err := newCertProvider(func() ([]byte, []byte, []byte, error) {
+		return []byte(cfg.Get(cfg.CAcert, "")), []byte(cfg.Get(cfg.TLScrt, "")), []byte(cfg.Get(cfg.TLSkey, "")), nil
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	cfg.AppConfig.AddChangeNotificationFunc(func() {
+		select {
+		case <-p.done:
+		default:
+			p.Reload()
+		}
+	})
+	return p, nil
+}
+
+func (p *CertProvider) watch() {
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-p.done:
+			return
+		case _, ok := <-p.watcher.Events:
+			if !ok {
+				return
+			}
+			reload = time.After(certReloadDelay)
+		case err, ok := <-p.watcher.Errors:
+			if !ok {
+				return
+			}
+			p.logger.Log(util.LogError, err.Error())
+		case <-reload:
+			reload = nil
+			p.Reload()
+		}
+	}
+}
+
+// Reload loads the certificates again, on error the previous ones are kept
+func (p *CertProvider) Reload() error {
+	c, err := p.load()
+	rotation := CertRotation{Time: time.Now(), Err: err}
+	if err != nil {
+		p.logger.Log(util.LogError, "failed to reload certificates: "+err.Error())
+	} else {
+		p.current.Store(c)
+		rotation.Leaf = c.cert.Leaf
+		p.logger.Log(util.LogInfo, "certificates loaded", "subject", c.cert.Leaf.Subject.String(), "not_after", c.cert.Leaf.NotAfter)
+	}
+
+	select {
+	case p.events <- rotation:
+	default:
+	}
+	return err
+}
+
+func (p *CertProvider) load() (*certificates, error) {
+	caCert, certPEM, keyPEM, err := p.source()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("tls: no ca certificate found")
+	}
+	return &certificates{cert: &cert, pool: pool}, nil
+}
+
+func (p *CertProvider) certificates() (*certificates, error) {
+	c, ok := p.current.Load().(*certificates)
+	if !ok {
+		return nil, ErrNoCertificate
+	}
+	return c, nil
+}
+
+// Events returns the rotations done by the provider, rotations are dropped
+// when nobody receives them
+func (p *CertProvider) Events() <-chan CertRotation {
+	return p.events
+}
+
+// Certificate returns the current certificate
+func (p *CertProvider) Certificate() (*tls.Certificate, error) {
+	c, err := p.certificates()
+	if err != nil {
+		return nil, err
+	}
+	return c.cert, nil
+}
+
+// GetCertificate returns the current certificate, to be used as tls.Config.GetCertificate
+func (p *CertProvider) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return p.Certificate()
+}
+
+// GetClientCertificate returns the current certificate, to be used as tls.Config.GetClientCertificate
+func (p *CertProvider) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return p.Certificate()
+}
+
+// VerifyPeerCertificate verifies the client certificate chain against the current ca certificate,
+// to be used as tls.Config.VerifyPeerCertificate
+func (p *CertProvider) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return p.verify(rawCerts, "", x509.ExtKeyUsageClientAuth)
+}
+
+func (p *CertProvider) verify(rawCerts [][]byte, serverName string, usage x509.ExtKeyUsage) error {
+	c, err := p.certificates()
+	if err != nil {
+		return err
+	}
+	if len(rawCerts) == 0 {
+		return errors.New("tls: peer sent no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         c.pool,
+		Intermediates: x509.NewCertPool(),
+		DNSName:       serverName,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	var leaf *x509.Certificate
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			opts.Intermediates.AddCert(cert)
+		}
+	}
+	_, err = leaf.Verify(opts)
+	return err
+}
+
+// ServerTLSConfig returns server config using the current certificates,
+// mutual requires clients to send a certificate signed by the ca for client auth.
+// Client certificates are verified by the handshake against the ca current when
+// it starts, so their chains are in tls.ConnectionState.VerifiedChains.
+func (p *CertProvider) ServerTLSConfig(mutual bool) *tls.Config {
+	config := &tls.Config{
+		GetCertificate: p.GetCertificate,
+		// set before grpc and net/http clone the config, GetConfigForClient returns a copy
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if mutual {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := p.certificates()
+			if err != nil {
+				return nil, err
+			}
+			handshake := config.Clone()
+			handshake.GetConfigForClient = nil
+			handshake.ClientCAs = c.pool
+			return handshake, nil
+		}
+	}
+	return config
+}
+
+// ClientTLSConfig returns client config using the current certificates,
+// the server certificate is verified against the current ca for the dialed server name
+func (p *CertProvider) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: p.GetClientCertificate,
+		// verification is done by VerifyConnection with the current ca
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			rawCerts := make([][]byte, len(cs.PeerCertificates))
+			for i, cert := range cs.PeerCertificates {
+				rawCerts[i] = cert.Raw
+			}
+			return p.verify(rawCerts, cs.ServerName, x509.ExtKeyUsageServerAuth)
+		},
+	}
+}
+
+// ServerCredentials returns grpc server credentials using ServerTLSConfig
+func (p *CertProvider) ServerCredentials(mutual bool) credentials.TransportCredentials {
+	return credentials.NewTLS(p.ServerTLSConfig(mutual))
+}
+
+// ClientCredentials returns grpc client credentials using ClientTLSConfig
+func (p *CertProvider) ClientCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(p.ClientTLSConfig())
+}
+
+// Close stops watching the certificate files
+func (p *CertProvider) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.done)
+		if p.watcher != nil {
+			err = p.watcher.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,114 @@
+package grpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns certificate and key in PEM for the template signed by the ca,
+// usable for server and client auth unless the template sets ExtKeyUsage
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if template.ExtKeyUsage == nil {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeTestCerts(t *testing.T, dir string, ca *testCA, serial int64) {
+	cert, key := ca.issue(t, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+	})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca.pem"), ca.pem, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cert.pem"), cert, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key.pem"), key, 0600))
+}
+
+func TestFileCertProviderRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	writeTestCerts(t, dir, ca, 2)
+	provider, err := NewFileCertProvider(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), log.NewNopLogger())
+	require.NoError(t, err)
+	defer provider.Close()
+
+	rotation := <-provider.Events()
+	require.NoError(t, rotation.Err)
+	require.Equal(t, int64(2), rotation.Leaf.SerialNumber.Int64())
+
+	writeTestCerts(t, dir, ca, 3)
+	select {
+	case rotation = <-provider.Events():
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificates were not reloaded")
+	}
+	require.NoError(t, rotation.Err)
+	require.Equal(t, int64(3), rotation.Leaf.SerialNumber.Int64())
+
+	cert, err := provider.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), cert.Leaf.SerialNumber.Int64())
+	require.NoError(t, provider.VerifyPeerCertificate(cert.Certificate, nil))
+
+	// an invalid rotation keeps the current certificate
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key.pem"), []byte("invalid"), 0600))
+	require.Error(t, provider.Reload())
+	cert, err = provider.Certificate()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), cert.Leaf.SerialNumber.Int64())
+
+	other, _ := newTestCA(t).issue(t, &x509.Certificate{SerialNumber: big.NewInt(4)})
+	block, _ := pem.Decode(other)
+	require.Error(t, provider.VerifyPeerCertificate([][]byte{block.Bytes}, nil))
+}
@@ -0,0 +1,308 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+	util "github.com/uninus-opensource/uninus-go-architect-common/log"
+)
+
+var (
+	// DefaultCORSMethods are methods allowed when the policy does not set any
+	DefaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE"}
+	// DefaultCORSHeaders are headers allowed when the policy does not set any
+	DefaultCORSHeaders = []string{"Content-Type", "Accept", "Authorization"}
+	// DefaultCORSMaxAge is preflight cache duration used when the policy does not set any
+	DefaultCORSMaxAge = 24 * time.Hour
+)
+
+// errCORSAnyOriginCredentials is returned by CORSPolicy.Validate for credentials allowed to every origin
+var errCORSAnyOriginCredentials = errors.New("cors: credentials can not be allowed to every origin")
+
+// CORSPolicy describes which cross-origin requests are accepted.
+// Requests with an Origin header not allowed by the policy are served without
+// CORS headers, or answered with 403 with RejectDisallowed.
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins, e.g. "https://app.uninus.id".
+	// "*" allows every origin, answered with a literal "*" and never with credentials.
+	// "*" inside an origin matches any subdomain or port part, e.g. "https://*.uninus.id".
+	AllowedOrigins []string
+	// AllowedOriginPatterns are regular expressions matched against the origin
+	AllowedOriginPatterns []string
+	AllowedMethods        []string
+	AllowedHeaders        []string
+	ExposedHeaders        []string
+	AllowCredentials      bool
+	MaxAge                time.Duration
+	// RejectDisallowed answers requests from origins not allowed with 403
+	RejectDisallowed bool
+}
+
+// defaultCORSOriginPattern matches the origins of uninus.id and its subdomains
+const defaultCORSOriginPattern = `^https?://(?:[a-z0-9-]+\.)*uninus\.id(?::\d{1,5})?$`
+
+// DefaultCORSPolicy returns policy accepting uninus.id and its subdomains, other origins are rejected
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOriginPatterns: []string{defaultCORSOriginPattern},
+		AllowCredentials:      true,
+		RejectDisallowed:      true,
+	}
+}
+
+// AllowedOriginsCORSPolicy returns policy accepting the listed origins only,
+// with credentials unless every origin is allowed by "*"
+func AllowedOriginsCORSPolicy(origins ...string) CORSPolicy {
+	policy := CORSPolicy{AllowedOrigins: origins, AllowCredentials: true}
+	for _, origin := range origins {
+		if strings.TrimSpace(origin) == "*" {
+			policy.AllowCredentials = false
+		}
+	}
+	return policy
+}
+
+// Validate returns an error for the invalid origin patterns of the policy,
+// and for credentials allowed to every origin
+func (p CORSPolicy) Validate() error {
+	_, err := p.compile()
+	return err
+}
+
+type corsMatcher struct {
+	policy   CORSPolicy
+	any      bool
+	origins  map[string]bool
+	patterns []*regexp.Regexp
+	methods  string
+	headers  string
+	exposed  string
+	maxAge   string
+}
+
+// compile returns the matcher of the policy, invalid patterns are left out of it and returned as error
+func (p CORSPolicy) compile() (*corsMatcher, error) {
+	m := &corsMatcher{
+		policy:  p,
+		origins: make(map[string]bool),
+		methods: strings.Join(DefaultCORSMethods, ","),
+		headers: strings.Join(DefaultCORSHeaders, ","),
+		exposed: strings.Join(p.ExposedHeaders, ","),
+		maxAge:  strconv.Itoa(int(DefaultCORSMaxAge.Seconds())),
+	}
+
+	for _, origin := range p.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "":
+		case origin == "*":
+			m.any = true
+		case strings.Contains(origin, "*"):
+			pattern := strings.Replace(regexp.QuoteMeta(origin), `\*`, `[a-z0-9.-]*`, -1)
+			m.patterns = append(m.patterns, regexp.MustCompile("^"+pattern+"$"))
+		default:
+			m.origins[origin] = true
+		}
+	}
+	var errs []error
+	for _, pattern := range p.AllowedOriginPatterns {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cors: invalid origin pattern %q: %w", pattern, err))
+			continue
+		}
+		m.patterns = append(m.patterns, r)
+	}
+	if m.any && p.AllowCredentials {
+		errs = append(errs, errCORSAnyOriginCredentials)
+	}
+
+	if len(p.AllowedMethods) > 0 {
+		m.methods = strings.Join(p.AllowedMethods, ",")
+	}
+	if len(p.AllowedHeaders) > 0 {
+		m.headers = strings.Join(p.AllowedHeaders, ",")
+	}
+	if p.MaxAge > 0 {
+		m.maxAge = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+	return m, errors.Join(errs...)
+}
+
+// mustCompile returns the matcher of the policy, logging its errors
+func (p CORSPolicy) mustCompile() *corsMatcher {
+	m, err := p.compile()
+	if err != nil {
+		util.StdLogger().Log(util.LogError, err.Error())
+	}
+	return m
+}
+
+func (m *corsMatcher) allowed(origin string) bool {
+	if m.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if m.origins[origin] {
+		return true
+	}
+	for _, r := range m.patterns {
+		if r.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func corsHandler(handler http.Handler, matcher func() *corsMatcher) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		// the answer depends on the origin, also when it is not allowed
+		w.Header().Add("Vary", "Origin")
+
+		m := matcher()
+		if !m.allowed(origin) {
+			if m.policy.RejectDisallowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if m.any {
+			// an arbitrary origin is never echoed, nor allowed credentials
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if m.policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Headers", m.headers)
+			w.Header().Set("Access-Control-Allow-Methods", m.methods)
+			w.Header().Set("Access-Control-Max-Age", m.maxAge)
+			return
+		}
+		if m.exposed != "" {
+			w.Header().Set("Access-Control-Expose-Headers", m.exposed)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// CORSMiddleware returns middleware enabling cross-origin resource sharing for policy,
+// the errors of policy are logged, see CORSPolicy.Validate
+func CORSMiddleware(policy CORSPolicy) HTTPMiddleware {
+	m := policy.mustCompile()
+	return func(handler http.Handler) http.Handler {
+		return corsHandler(handler, func() *corsMatcher { return m })
+	}
+}
+
+// ConfigCORSPolicy returns policy read from config.AppConfig,
+// keys missing from the config are taken from defaults
+func ConfigCORSPolicy(defaults CORSPolicy) CORSPolicy {
+	policy := defaults
+	if v := configList(cfg.CORSAllowedOrigins); v != nil {
+		policy.AllowedOrigins = v
+	}
+	if v := configList(cfg.CORSAllowedOriginPatterns); v != nil {
+		policy.AllowedOriginPatterns = v
+	}
+	if v := configList(cfg.CORSAllowedMethods); v != nil {
+		policy.AllowedMethods = v
+	}
+	if v := configList(cfg.CORSAllowedHeaders); v != nil {
+		policy.AllowedHeaders = v
+	}
+	if v := configList(cfg.CORSExposedHeaders); v != nil {
+		policy.ExposedHeaders = v
+	}
+	if v, err := strconv.ParseBool(cfg.Get(cfg.CORSAllowCredentials, "")); err == nil {
+		policy.AllowCredentials = v
+	}
+	if v, err := strconv.Atoi(cfg.Get(cfg.CORSMaxAge, "")); err == nil {
+		policy.MaxAge = time.Duration(v) * time.Second
+	}
+	return policy
+}
+
+// configCORSPolicy is the policy of CORSMiddlewareFromConfig for defaults
+type configCORSPolicy struct {
+	defaults CORSPolicy
+	current  atomic.Value
+}
+
+func (p *configCORSPolicy) reload() {
+	m, err := ConfigCORSPolicy(p.defaults).compile()
+	if err != nil {
+		util.StdLogger().Log(util.LogError, "invalid cors policy: "+err.Error())
+		return
+	}
+	p.current.Store(m)
+}
+
+var (
+	configCORSOnce     sync.Once
+	configCORSMu       sync.Mutex
+	configCORSPolicies = map[string]*configCORSPolicy{}
+)
+
+// CORSMiddlewareFromConfig returns CORS middleware using ConfigCORSPolicy,
+// the policy is reloaded every time config.AppConfig changes.
+// An invalid policy is logged, the previous one is kept on reload.
+// The policies are reloaded by a single config hook and shared by the calls with the same defaults.
+func CORSMiddlewareFromConfig(defaults CORSPolicy) HTTPMiddleware {
+	configCORSOnce.Do(func() {
+		cfg.AppConfig.AddChangeNotificationFunc(func() {
+			configCORSMu.Lock()
+			defer configCORSMu.Unlock()
+			for _, p := range configCORSPolicies {
+				p.reload()
+			}
+		})
+	})
+
+	key := fmt.Sprintf("%#v", defaults)
+	configCORSMu.Lock()
+	p, ok := configCORSPolicies[key]
+	if !ok {
+		p = &configCORSPolicy{defaults: defaults}
+		p.current.Store(ConfigCORSPolicy(defaults).mustCompile())
+		configCORSPolicies[key] = p
+	}
+	configCORSMu.Unlock()
+
+	return func(handler http.Handler) http.Handler {
+		return corsHandler(handler, func() *corsMatcher { return p.current.Load().(*corsMatcher) })
+	}
+}
+
+func configList(key string) []string {
+	v := cfg.Get(key, "")
+	if v == "" {
+		return nil
+	}
+
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	policy := CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.tenant.id"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+	}
+	handler := CORSMiddleware(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	policy.RejectDisallowed = true
+	rejecting := CORSMiddleware(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", true},
+		{"https://app.example.com", true},
+		{"https://a.tenant.id", true},
+		{"https://evil.com", false},
+		{"https://app.example.com.evil.com", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code, tt.origin)
+		switch {
+		case tt.origin == "":
+		case tt.allowed:
+			require.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			require.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+			require.Equal(t, "X-Request-Id", w.Header().Get("Access-Control-Expose-Headers"))
+		default:
+			require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			require.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+		}
+
+		w = httptest.NewRecorder()
+		rejecting.ServeHTTP(w, r)
+		if tt.allowed {
+			require.Equal(t, http.StatusOK, w.Code, tt.origin)
+		} else {
+			require.Equal(t, http.StatusForbidden, w.Code, tt.origin)
+		}
+	}
+
+	r := httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, "GET,HEAD,POST,PUT,DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "86400", w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	policy := AllowedOriginsCORSPolicy("*")
+	require.False(t, policy.AllowCredentials)
+	require.NoError(t, policy.Validate())
+
+	policy.AllowCredentials = true
+	require.Error(t, policy.Validate())
+	handler := CORSMiddleware(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	require.Error(t, CORSPolicy{AllowedOriginPatterns: []string{"("}}.Validate())
+}
+
+func TestDefaultCORSPolicy(t *testing.T) {
+	handler := CORSMiddleware(DefaultCORSPolicy())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://uninus.id", true},
+		{"https://app.uninus.id:8443", true},
+		{"https://uninus.id.evil.com", false},
+		{"https://uninus.id/path", false},
+		{"https://eviluninus.id", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", tt.origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, "Origin", w.Header().Get("Vary"), tt.origin)
+		if tt.allowed {
+			require.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+		} else {
+			require.Equal(t, http.StatusForbidden, w.Code, tt.origin)
+			require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
+
+func TestCORSMiddlewareFromConfigShared(t *testing.T) {
+	CORSMiddlewareFromConfig(AllowedOriginsCORSPolicy("https://app.example.com"))
+	CORSMiddlewareFromConfig(AllowedOriginsCORSPolicy("https://app.example.com"))
+	configCORSMu.Lock()
+	defer configCORSMu.Unlock()
+	require.Len(t, configCORSPolicies, 1)
+}
@@ -0,0 +1,306 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	middle "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+	uerrors "github.com/uninus-opensource/uninus-go-architect-common/errors"
+	util "github.com/uninus-opensource/uninus-go-architect-common/log"
+)
+
+const (
+	// GrpcTimeoutHeader is the grpc timeout header, e.g. "500m" for 500ms
+	GrpcTimeoutHeader = "Grpc-Timeout"
+	// RequestTimeoutHeader is the timeout header of http clients, e.g. "500ms" or "2" for 2s
+	RequestTimeoutHeader = "X-Request-Timeout"
+	// DefaultGrpcClientDeadlineMargin is removed from outgoing deadlines so the
+	// caller has time to handle the response before its own deadline
+	DefaultGrpcClientDeadlineMargin = 50 * time.Millisecond
+	// CodeDeadlineExceeded is the application error code of timed out calls
+	CodeDeadlineExceeded = "DEADLINE_EXCEEDED"
+)
+
+// ErrDeadlineExceeded is returned for calls timed out by the deadline interceptors
+var ErrDeadlineExceeded error = uerrors.NewAppError(codes.DeadlineExceeded, CodeDeadlineExceeded, "Request timed out")
+
+// DeadlineLimiter returns the max deadline of method, a grpc full method or
+// a http path, zero when it is not limited
+type DeadlineLimiter interface {
+	MaxDeadline(method string) time.Duration
+}
+
+// DeadlinePolicy maps methods to their max deadline. Methods are path.Match
+// patterns like IdentityPolicy, "*" alone matches every method.
+type DeadlinePolicy map[string]time.Duration
+
+// MaxDeadline returns the max deadline of the most specific pattern matching method
+func (p DeadlinePolicy) MaxDeadline(method string) time.Duration {
+	d, _ := lookupMethod(p, method)
+	return d
+}
+
+// ConfigDeadlinePolicy returns policy read from the json of config.GRPCMaxDeadlines,
+// e.g. {"*": "30s", "/uninus.auth.Auth/Login": "5s"}
+func ConfigDeadlinePolicy() (DeadlinePolicy, error) {
+	policy := DeadlinePolicy{}
+	v := strings.TrimSpace(cfg.Get(cfg.GRPCMaxDeadlines, ""))
+	if v == "" {
+		return policy, nil
+	}
+	var durations map[string]string
+	if err := json.Unmarshal([]byte(v), &durations); err != nil {
+		return nil, err
+	}
+	for method, duration := range durations {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, err
+		}
+		policy[method] = d
+	}
+	return policy, nil
+}
+
+type configDeadlineLimiter struct {
+	current atomic.Value
+}
+
+func (l *configDeadlineLimiter) MaxDeadline(method string) time.Duration {
+	return l.current.Load().(DeadlinePolicy).MaxDeadline(method)
+}
+
+var (
+	configDeadlineOnce sync.Once
+	configDeadlines    *configDeadlineLimiter
+)
+
+// ConfigDeadlineLimiter returns limiter using ConfigDeadlinePolicy,
+// the policy is reloaded every time config.AppConfig changes.
+// The limiter is made once per process and shared by the callers, an invalid
+// policy is logged by the logger of the first call and the previous one is kept.
+func ConfigDeadlineLimiter(logger log.Logger) DeadlineLimiter {
+	configDeadlineOnce.Do(func() {
+		l := &configDeadlineLimiter{}
+		load := func() {
+			policy, err := ConfigDeadlinePolicy()
+			if err != nil {
+				logger.Log(util.LogError, "invalid "+cfg.GRPCMaxDeadlines+": "+err.Error())
+				if l.current.Load() != nil {
+					return
+				}
+				policy = DeadlinePolicy{}
+			}
+			l.current.Store(policy)
+		}
+		load()
+		cfg.AppConfig.AddChangeNotificationFunc(load)
+		configDeadlines = l
+	})
+	return configDeadlines
+}
+
+// limitDeadline returns ctx with a deadline of at most max from now, ctx as is when max is zero
+func limitDeadline(ctx context.Context, max time.Duration) (context.Context, context.CancelFunc) {
+	if max <= 0 {
+		return ctx, func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= max {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, max)
+}
+
+// deadlineError returns ErrDeadlineExceeded when err is caused by the deadline of ctx,
+// so timeouts are not reported as Unknown or Canceled
+func deadlineError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrDeadlineExceeded
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		switch status.Code(err) {
+		case codes.Unknown, codes.Canceled:
+			return ErrDeadlineExceeded
+		}
+	}
+	return err
+}
+
+// UnaryServerDeadlineInterceptor returns grpc interceptor limiting the deadline of calls to
+// the max deadline of their method, calls timing out return DeadlineExceeded
+func UnaryServerDeadlineInterceptor(limiter DeadlineLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := limitDeadline(ctx, limiter.MaxDeadline(info.FullMethod))
+		defer cancel()
+		resp, err := handler(ctx, req)
+		return resp, deadlineError(ctx, err)
+	}
+}
+
+// StreamServerDeadlineInterceptor returns grpc interceptor limiting the deadline of streams to
+// the max deadline of their method, streams timing out return DeadlineExceeded
+func StreamServerDeadlineInterceptor(limiter DeadlineLimiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := limitDeadline(stream.Context(), limiter.MaxDeadline(info.FullMethod))
+		defer cancel()
+		wrapped := middle.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return deadlineError(ctx, handler(srv, wrapped))
+	}
+}
+
+// ParseGrpcTimeout parses the value of GrpcTimeoutHeader, an integer of at most
+// 8 digits followed by the unit H, M, S, m, u or n
+func ParseGrpcTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, errors.New("invalid grpc timeout " + v)
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, errors.New("invalid grpc timeout unit " + v)
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid grpc timeout " + v)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// requestTimeout returns the timeout asked by the request headers, zero when none
+func requestTimeout(r *http.Request) time.Duration {
+	if v := r.Header.Get(GrpcTimeoutHeader); v != "" {
+		if d, err := ParseGrpcTimeout(v); err == nil {
+			return d
+		}
+	}
+	if v := r.Header.Get(RequestTimeoutHeader); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(n * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// DeadlineMiddleware returns http middleware setting the request context deadline from
+// GrpcTimeoutHeader or RequestTimeoutHeader, limited by the max deadline of the request path.
+// The gateway passes the deadline to the grpc calls of the request.
+func DeadlineMiddleware(limiter DeadlineLimiter) HTTPMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			timeout := requestTimeout(r)
+			if max := limiter.MaxDeadline(r.URL.Path); max > 0 && (timeout <= 0 || timeout > max) {
+				timeout = max
+			}
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientDeadline returns ctx with its deadline shrunk by margin, or a deadline
+// of timeout from now when ctx has none and timeout is set
+func clientDeadline(ctx context.Context, margin, timeout time.Duration) (context.Context, context.CancelFunc, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		if timeout <= 0 {
+			return ctx, func() {}, nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		return ctx, cancel, nil
+	}
+	if margin <= 0 {
+		return ctx, func() {}, nil
+	}
+	if time.Until(deadline) <= margin {
+		return ctx, func() {}, ErrDeadlineExceeded
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline.Add(-margin))
+	return ctx, cancel, nil
+}
+
+// UnaryClientDeadlineInterceptor returns grpc client interceptor removing margin from the
+// deadline of calls, calls without deadline get timeout when it is set.
+// Calls with less than margin left fail at once with DeadlineExceeded.
+func UnaryClientDeadlineInterceptor(margin, timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel, err := clientDeadline(ctx, margin, timeout)
+		defer cancel()
+		if err != nil {
+			return err
+		}
+		return deadlineError(ctx, invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// StreamClientDeadlineInterceptor is UnaryClientDeadlineInterceptor for streams,
+// the deadline applies to the whole stream
+func StreamClientDeadlineInterceptor(margin, timeout time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, cancel, err := clientDeadline(ctx, margin, timeout)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, deadlineError(ctx, err)
+		}
+		return &deadlineClientStream{ClientStream: stream, ctx: ctx, cancel: cancel, serverStreams: desc.ServerStreams}, nil
+	}
+}
+
+// deadlineClientStream releases the deadline of the stream when it ends
+type deadlineClientStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	// serverStreams is false when the stream ends with the first response, e.g. CloseAndRecv
+	serverStreams bool
+}
+
+func (s *deadlineClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		s.cancel()
+		return err
+	}
+	if err != nil || !s.serverStreams {
+		s.cancel()
+	}
+	return deadlineError(s.ctx, err)
+}
@@ -0,0 +1,129 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseGrpcTimeout(t *testing.T) {
+	d, err := ParseGrpcTimeout("500m")
+	require.NoError(t, err)
+	require.Equal(t, 500*time.Millisecond, d)
+	d, err = ParseGrpcTimeout("2S")
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Second, d)
+	_, err = ParseGrpcTimeout("5x")
+	require.Error(t, err)
+	_, err = ParseGrpcTimeout("123456789S")
+	require.Error(t, err)
+}
+
+func TestUnaryServerDeadlineInterceptor(t *testing.T) {
+	policy := DeadlinePolicy{"*": time.Minute, "/test.Service/*": 20 * time.Millisecond}
+	interceptor := UnaryServerDeadlineInterceptor(policy)
+
+	var remaining time.Duration
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, _ := ctx.Deadline()
+		remaining = time.Until(deadline)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}, handler)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	require.True(t, remaining <= 20*time.Millisecond, remaining)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/other.Service/Call"}, handler)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	require.True(t, remaining <= 10*time.Millisecond, remaining)
+}
+
+func TestDeadlineMiddleware(t *testing.T) {
+	var remaining time.Duration
+	var hasDeadline bool
+	handler := DeadlineMiddleware(DeadlinePolicy{"/v1/slow/*": time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var deadline time.Time
+		deadline, hasDeadline = r.Context().Deadline()
+		remaining = time.Until(deadline)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/fast", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.False(t, hasDeadline)
+
+	r.Header.Set(RequestTimeoutHeader, "200ms")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.True(t, hasDeadline)
+	require.True(t, remaining > 100*time.Millisecond && remaining <= 200*time.Millisecond, remaining)
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/slow/report", nil)
+	r.Header.Set(GrpcTimeoutHeader, "1M")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.True(t, remaining <= time.Second, remaining)
+}
+
+func TestUnaryClientDeadlineInterceptor(t *testing.T) {
+	interceptor := UnaryClientDeadlineInterceptor(50*time.Millisecond, time.Second)
+	var remaining time.Duration
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, _ := ctx.Deadline()
+		remaining = time.Until(deadline)
+		return nil
+	}
+
+	require.NoError(t, interceptor(context.Background(), "/test.Service/Call", nil, nil, nil, invoker))
+	require.True(t, remaining > 900*time.Millisecond && remaining <= time.Second, remaining)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.NoError(t, interceptor(ctx, "/test.Service/Call", nil, nil, nil, invoker))
+	require.True(t, remaining <= 150*time.Millisecond, remaining)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := interceptor(ctx, "/test.Service/Call", nil, nil, nil, invoker)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+type recvClientStream struct {
+	grpc.ClientStream
+	ctx context.Context
+	err error
+}
+
+func (s *recvClientStream) RecvMsg(m interface{}) error {
+	return s.err
+}
+
+func TestStreamClientDeadlineInterceptor(t *testing.T) {
+	var stream *recvClientStream
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream = &recvClientStream{ctx: ctx}
+		return stream, nil
+	}
+	interceptor := StreamClientDeadlineInterceptor(0, 10*time.Millisecond)
+
+	// the end of a server stream is returned as is, even after the deadline
+	cs, err := interceptor(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/test.Service/List", streamer)
+	require.NoError(t, err)
+	<-stream.ctx.Done()
+	stream.err = io.EOF
+	require.Equal(t, io.EOF, cs.RecvMsg(nil))
+
+	// the deadline of a client stream is released by its response
+	cs, err = interceptor(context.Background(), &grpc.StreamDesc{ClientStreams: true}, nil, "/test.Service/Upload", streamer)
+	require.NoError(t, err)
+	require.NoError(t, cs.RecvMsg(nil))
+	require.Equal(t, context.Canceled, stream.ctx.Err())
+}
@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	uerrors "github.com/uninus-opensource/uninus-go-architect-common/errors"
+)
+
+const (
+	// StatusSuccess is Response status of successful calls
+	StatusSuccess = "success"
+	// StatusError is Response status of failed calls
+	StatusError = "error"
+)
+
+// EnvelopeMarshaler marshals gateway responses wrapped in Response.
+// Streamed messages are wrapped one by one so every line of a stream is a Response.
+type EnvelopeMarshaler struct {
+	*runtime.JSONPb
+}
+
+// NewEnvelopeMarshaler returns envelope marshaler using the gateway default json options
+func NewEnvelopeMarshaler() *EnvelopeMarshaler {
+	return &EnvelopeMarshaler{JSONPb: &runtime.JSONPb{OrigName: true, EmitDefaults: true}}
+}
+
+// streamError is the error chunk sent by the gateway when a stream fails
+type streamError interface {
+	GetGrpcCode() int32
+	GetMessage() string
+	GetDetails() []*anypb.Any
+}
+
+// Marshal wraps marshaled v into Response
+func (m *EnvelopeMarshaler) Marshal(v interface{}) ([]byte, error) {
+	switch chunk := v.(type) {
+	case map[string]interface{}:
+		if result, ok := chunk["result"]; ok && len(chunk) == 1 {
+			v = result
+		}
+	case map[string]proto.Message:
+		if serr, ok := chunk["error"].(streamError); ok {
+			s := status.FromProto(&spb.Status{
+				Code:    serr.GetGrpcCode(),
+				Message: serr.GetMessage(),
+				Details: serr.GetDetails(),
+			})
+			return json.Marshal(errorResponse(s))
+		}
+	}
+
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&Response{Status: StatusSuccess, Data: json.RawMessage(data)})
+}
+
+// ContentType always returns json
+func (m *EnvelopeMarshaler) ContentType() string {
+	return "application/json"
+}
+
+// EnvelopeServeMuxOptions returns gateway options enabling the response envelope
+func EnvelopeServeMuxOptions() []runtime.ServeMuxOption {
+	return []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, NewEnvelopeMarshaler()),
+		runtime.WithProtoErrorHandler(HttpErrorHandler),
+	}
+}
+
+// HttpErrorHandler writes err as error Response with the http status matching its grpc code
+func HttpErrorHandler(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	s, ok := status.FromError(err)
+	if !ok {
+		s = status.New(codes.Unknown, err.Error())
+	}
+
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			for _, v := range vs {
+				w.Header().Add(runtime.MetadataHeaderPrefix+k, v)
+			}
+		}
+	}
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", "application/json")
+	if delay := uerrors.FromStatus(s).RetryDelay; delay > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	}
+	w.WriteHeader(runtime.HTTPStatusFromCode(s.Code()))
+
+	bs, _ := json.Marshal(errorResponse(s))
+	if _, err := w.Write(bs); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+}
+
+func errorResponse(s *status.Status) *Response {
+	messages := InfoMessages(s)
+	return &Response{
+		Status:   StatusError,
+		Messages: &messages,
+	}
+}
+
+// InfoMessages returns messages describing s, one for each supported status detail
+func InfoMessages(s *status.Status) []InfoMessage {
+	var messages []InfoMessage
+	for _, detail := range s.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			messages = append(messages, InfoMessage{Code: d.GetReason(), Message: s.Message()})
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				messages = append(messages, InfoMessage{Code: v.GetField(), Message: v.GetDescription()})
+			}
+		case *errdetails.PreconditionFailure:
+			for _, v := range d.GetViolations() {
+				messages = append(messages, InfoMessage{Code: v.GetType(), Message: v.GetDescription()})
+			}
+		case *errdetails.QuotaFailure:
+			for _, v := range d.GetViolations() {
+				messages = append(messages, InfoMessage{Code: v.GetSubject(), Message: v.GetDescription()})
+			}
+		case *errdetails.LocalizedMessage:
+			messages = append(messages, InfoMessage{Code: d.GetLocale(), Message: d.GetMessage()})
+		}
+	}
+	if len(messages) > 0 {
+		return messages
+	}
+
+	// services without status details put their own code in front of the message
+	code := strconv.Itoa(int(s.Code()))
+	message := s.Message()
+	if errMsg := strings.Split(message, ":"); len(errMsg) == 2 {
+		code = errMsg[0]
+		message = errMsg[1]
+	}
+	return []InfoMessage{{Code: code, Message: message}}
+}
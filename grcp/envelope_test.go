@@ -0,0 +1,80 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	uerrors "github.com/uninus-opensource/uninus-go-architect-common/errors"
+)
+
+func TestEnvelopeMarshaler(t *testing.T) {
+	m := NewEnvelopeMarshaler()
+	msg, err := structpb.NewStruct(map[string]interface{}{"name": "uninus"})
+	require.NoError(t, err)
+
+	buf, err := m.Marshal(msg)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"status":"success","data":{"name":"uninus"}}`, string(buf))
+
+	buf, err = m.Marshal(map[string]interface{}{"result": msg})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"status":"success","data":{"name":"uninus"}}`, string(buf))
+}
+
+func TestHttpErrorHandler(t *testing.T) {
+	s, err := status.New(codes.InvalidArgument, "invalid request").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "email", Description: "email is required"},
+			{Field: "name", Description: "name is too long"},
+		},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	HttpErrorHandler(context.Background(), nil, nil, w, httptest.NewRequest("GET", "/", nil), s.Err())
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, StatusError, resp.Status)
+	require.Equal(t, []InfoMessage{
+		{Code: "email", Message: "email is required"},
+		{Code: "name", Message: "name is too long"},
+	}, *resp.Messages)
+
+	w = httptest.NewRecorder()
+	HttpErrorHandler(context.Background(), nil, nil, w, httptest.NewRequest("GET", "/", nil), errors.New("boom"))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestHttpErrorHandlerAppError(t *testing.T) {
+	appErr := uerrors.NewAppError(codes.Unavailable, "MAINTENANCE", "service is under maintenance").
+		WithRetryDelay(1500 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	HttpErrorHandler(context.Background(), nil, nil, w, httptest.NewRequest("GET", "/", nil), appErr)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	var resp Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, []InfoMessage{{Code: "MAINTENANCE", Message: "service is under maintenance"}}, *resp.Messages)
+}
+
+func TestInfoMessagesLegacyCode(t *testing.T) {
+	require.Equal(t, []InfoMessage{{Code: "E042", Message: "quota exceeded"}},
+		InfoMessages(status.New(codes.ResourceExhausted, "E042:quota exceeded")))
+	require.Equal(t, []InfoMessage{{Code: "5", Message: "not found"}},
+		InfoMessages(status.New(codes.NotFound, "not found")))
+}
@@ -32,39 +32,47 @@ type ClientOption struct {
 	RetryTimeout time.Duration
 	// ...
 	MaxCallRecvMsgSize int
+	// RetryPolicy retries failed calls on the connection when set
+	RetryPolicy *RetryPolicy
+	// CircuitBreaker guards the calls on the connection when set
+	CircuitBreaker *CircuitBreakerOption
+	// DeadlineMargin is removed from the deadline of calls, Timeout is
+	// the deadline of calls made without one
+	DeadlineMargin time.Duration
+	// DialOptions are added to the options dialing the instances, e.g. the dialer of grpctest
+	DialOptions []grpc.DialOption
 }
 
-func grpcConnection(address string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
-	var conn *grpc.ClientConn
-	var err error
+// dialOptions returns the options dialing instance with o,
+// retries are made within the deadline and through the circuit breaker
+func (o ClientOption) dialOptions(instance string, logger log.Logger) []grpc.DialOption {
 	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor()))
-	if strings.Contains(address, "dns:///") {
-		resolver.Register(dns.NewBuilder())
-		opts = append(opts, grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
+	if o.MaxCallRecvMsgSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(o.MaxCallRecvMsgSize)))
 	}
-	if strings.Contains(address, "kubernetes:///") {
-		//iresolver.RegisterInCluster()
-		opts = append(opts, grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
+	if o.Timeout > 0 || o.DeadlineMargin > 0 {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(UnaryClientDeadlineInterceptor(o.DeadlineMargin, o.Timeout)))
+		opts = append(opts, grpc.WithChainStreamInterceptor(StreamClientDeadlineInterceptor(o.DeadlineMargin, o.Timeout)))
 	}
-	if creds == nil {
-		opts = append(opts, grpc.WithInsecure())
-		conn, err = grpc.Dial(address, opts...)
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-		conn, err = grpc.Dial(address, opts...)
+	if o.RetryPolicy != nil {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(UnaryClientRetryInterceptor(*o.RetryPolicy)))
+		opts = append(opts, grpc.WithChainStreamInterceptor(StreamClientRetryInterceptor(*o.RetryPolicy)))
 	}
-	if err != nil {
-		return nil, err
+	if o.CircuitBreaker != nil {
+		breakers := newCircuitBreakers(instance, *o.CircuitBreaker, logger)
+		opts = append(opts, grpc.WithChainUnaryInterceptor(breakers.unary))
+		opts = append(opts, grpc.WithChainStreamInterceptor(breakers.stream))
 	}
-	return conn, nil
+	return append(opts, o.DialOptions...)
 }
 
-func grpcConnectionWithMaxCallRecvMsgSize(address string, creds credentials.TransportCredentials, maxCallRecvMsgSize int) (*grpc.ClientConn, error) {
+func grpcConnection(address string, creds credentials.TransportCredentials, dialOpts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	var conn *grpc.ClientConn
 	var err error
 	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxCallRecvMsgSize)))
+	opts = append(opts, grpc.WithChainUnaryInterceptor(apmgrpc.NewUnaryClientInterceptor(), UnaryClientRequestIDInterceptor(), UnaryClientMetricsInterceptor()))
+	opts = append(opts, grpc.WithChainStreamInterceptor(StreamClientRequestIDInterceptor(), StreamClientMetricsInterceptor()))
+	opts = append(opts, dialOpts...)
 	if strings.Contains(address, "dns:///") {
 		resolver.Register(dns.NewBuilder())
 		opts = append(opts, grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
@@ -86,7 +94,15 @@ func grpcConnectionWithMaxCallRecvMsgSize(address string, creds credentials.Tran
 	return conn, nil
 }
 
-// EndpointFactory returns endpoint factory
+// legacyClientOption returns the option of the factories without ClientOption,
+// their calls go through circuit breakers with DefaultCircuitBreakerOption
+func legacyClientOption(timeout time.Duration, maxCallRecvMsgSize int) ClientOption {
+	breaker := DefaultCircuitBreakerOption(timeout)
+	return ClientOption{MaxCallRecvMsgSize: maxCallRecvMsgSize, CircuitBreaker: &breaker}
+}
+
+// EndpointFactory returns endpoint factory, the calls to every instance go through
+// a circuit breaker with DefaultCircuitBreakerOption(timeout)
 func EndpointFactory(makeEndpoint func(*grpc.ClientConn, time.Duration, stdopentracing.Tracer, log.Logger) endpoint.Endpoint, creds credentials.TransportCredentials, timeout time.Duration, tracer stdopentracing.Tracer, logger log.Logger) sd.Factory {
 	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
 
@@ -94,7 +110,7 @@ func EndpointFactory(makeEndpoint func(*grpc.ClientConn, time.Duration, stdopent
 			return nil, nil, errors.New("Empty instance")
 		}
 
-		conn, err := grpcConnection(instance, creds)
+		conn, err := grpcConnection(instance, creds, legacyClientOption(timeout, 0).dialOptions(instance, logger)...)
 		if err != nil {
 			logger.Log("host", instance, ulog.LogError, err.Error())
 			return nil, nil, err
@@ -105,6 +121,8 @@ func EndpointFactory(makeEndpoint func(*grpc.ClientConn, time.Duration, stdopent
 	}
 }
 
+// EndpointFactoryWithMaxCallRecvMsgSize returns endpoint factory like EndpointFactory
+// receiving messages up to maxCallRecvMsgSize
 func EndpointFactoryWithMaxCallRecvMsgSize(makeEndpoint func(*grpc.ClientConn, time.Duration, stdopentracing.Tracer, log.Logger) endpoint.Endpoint, creds credentials.TransportCredentials, timeout time.Duration, tracer stdopentracing.Tracer, logger log.Logger, maxCallRecvMsgSize int) sd.Factory {
 	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
 
@@ -112,7 +130,7 @@ func EndpointFactoryWithMaxCallRecvMsgSize(makeEndpoint func(*grpc.ClientConn, t
 			return nil, nil, errors.New("Empty instance")
 		}
 
-		conn, err := grpcConnectionWithMaxCallRecvMsgSize(instance, creds, maxCallRecvMsgSize)
+		conn, err := grpcConnection(instance, creds, legacyClientOption(timeout, maxCallRecvMsgSize).dialOptions(instance, logger)...)
 		if err != nil {
 			logger.Log("host", instance, ulog.LogError, err.Error())
 			return nil, nil, err
@@ -123,29 +141,32 @@ func EndpointFactoryWithMaxCallRecvMsgSize(makeEndpoint func(*grpc.ClientConn, t
 	}
 }
 
-func GrpcConnection(address string, creds credentials.TransportCredentials, cb *gobreaker.CircuitBreaker) (*grpc.ClientConn, error) {
-	var conn *grpc.ClientConn
-	var err error
-	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithUnaryInterceptor(circuitBreakerClientInterceptor(cb)))
-	if strings.Contains(address, "dns:///") {
-		opts = append(opts, grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
-	}
-	if strings.Contains(address, "kubernetes:///") {
-		//iresolver.RegisterInCluster()
-		opts = append(opts, grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
-	}
-	if creds == nil {
-		opts = append(opts, grpc.WithInsecure())
-		conn, err = grpc.Dial(address, grpc.WithInsecure())
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-		conn, err = grpc.Dial(address, grpc.WithTransportCredentials(creds))
+// EndpointFactoryWithOption returns endpoint factory dialing instances with option,
+// option.Timeout is passed to makeEndpoint
+func EndpointFactoryWithOption(makeEndpoint func(*grpc.ClientConn, time.Duration, stdopentracing.Tracer, log.Logger) endpoint.Endpoint, creds credentials.TransportCredentials, option ClientOption, tracer stdopentracing.Tracer, logger log.Logger) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+
+		if instance == "" {
+			return nil, nil, errors.New("Empty instance")
+		}
+
+		conn, err := grpcConnection(instance, creds, option.dialOptions(instance, logger)...)
+		if err != nil {
+			logger.Log("host", instance, ulog.LogError, err.Error())
+			return nil, nil, err
+		}
+		endpoint := makeEndpoint(conn, option.Timeout, tracer, logger)
+
+		return endpoint, conn, nil
 	}
-	if err != nil {
-		return nil, err
+}
+
+// GrpcConnection returns connection to address guarded by cb, calls are not guarded when cb is nil
+func GrpcConnection(address string, creds credentials.TransportCredentials, cb *gobreaker.CircuitBreaker) (*grpc.ClientConn, error) {
+	if cb == nil {
+		return grpcConnection(address, creds)
 	}
-	return conn, nil
+	return grpcConnection(address, creds, grpc.WithChainUnaryInterceptor(circuitBreakerClientInterceptor(cb)))
 }
 
 func circuitBreakerClientInterceptor(cb *gobreaker.CircuitBreaker) grpc.UnaryClientInterceptor {
@@ -157,15 +178,8 @@ func circuitBreakerClientInterceptor(cb *gobreaker.CircuitBreaker) grpc.UnaryCli
 		invoker grpc.UnaryInvoker,
 		opts ...grpc.CallOption,
 	) error {
-		_, cbErr := cb.Execute(func() (interface{}, error) {
-			err := invoker(ctx, method, req, reply, cc, opts...)
-			if err != nil {
-				return nil, err
-			}
-
-			return nil, nil
-
+		return execute(cb, func() error {
+			return invoker(ctx, method, req, reply, cc, opts...)
 		})
-		return cbErr
 	}
 }
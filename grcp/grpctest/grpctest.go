@@ -0,0 +1,222 @@
+// Package grpctest serves grpc services in process over bufconn, with the
+// interceptors of the services and optionally their grpc gateway, so servers
+// and clients can be tested without real ports.
+package grpctest
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	run "github.com/uninus-opensource/uninus-go-architect-common/grcp"
+	"github.com/uninus-opensource/uninus-go-architect-common/healthcheck"
+)
+
+const (
+	// Address is the address of the in process server, use it as the instance
+	// given to the endpoint factories of grcp with ClientOption
+	Address = "passthrough:///bufnet"
+	// DefaultBufferSize is the buffer size of the bufconn listener
+	DefaultBufferSize = 1 << 20
+)
+
+type options struct {
+	logger         log.Logger
+	serverOpts     []grpc.ServerOption
+	defaultOpts    bool
+	register       run.RegisterHTTPHandler
+	gatewayOpts    []run.ServerOption
+	healthRegistry *healthcheck.Registry
+	bufferSize     int
+}
+
+// Option sets an optional parameter of Server
+type Option func(*options)
+
+// WithLogger sets the logger of the server interceptors
+func WithLogger(logger log.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithServerOptions adds opts to the options of the grpc server
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(o *options) { o.serverOpts = append(o.serverOpts, opts...) }
+}
+
+// WithoutDefaultServerOptions serves without grcp.DefaultServerOptions, e.g. to test an interceptor alone
+func WithoutDefaultServerOptions() Option {
+	return func(o *options) { o.defaultOpts = false }
+}
+
+// WithGateway serves the grpc gateway registered by register with httptest,
+// opts configure it like a grcp.Server, e.g. with grcp.WithCORSPolicy
+func WithGateway(register run.RegisterHTTPHandler, opts ...run.ServerOption) Option {
+	return func(o *options) {
+		o.register = register
+		o.gatewayOpts = append(o.gatewayOpts, opts...)
+	}
+}
+
+// WithHealthRegistry serves the grpc health service driven by registry,
+// the gateway also serves its probes
+func WithHealthRegistry(registry *healthcheck.Registry) Option {
+	return func(o *options) { o.healthRegistry = registry }
+}
+
+// WithBufferSize sets the buffer size of the bufconn listener
+func WithBufferSize(size int) Option {
+	return func(o *options) { o.bufferSize = size }
+}
+
+// Server is a grpc server listening in process
+type Server struct {
+	// GRPCServer is the grpc server, its services are registered before it serves
+	GRPCServer *grpc.Server
+	// Listener is the bufconn listener of GRPCServer
+	Listener *bufconn.Listener
+	// Health is the health service of GRPCServer, nil without WithHealthRegistry
+	Health *health.Server
+	// Gateway serves the grpc gateway, nil without WithGateway
+	Gateway *httptest.Server
+
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	conn      *grpc.ClientConn
+	conns     []*grpc.ClientConn
+	closeOnce sync.Once
+}
+
+// NewServer starts the grpc server with services registered by register, and the gateway
+// when set. The server is stopped when the test ends.
+func NewServer(t testing.TB, register func(*grpc.Server), opts ...Option) *Server {
+	t.Helper()
+	o := &options{
+		logger:      log.NewNopLogger(),
+		defaultOpts: true,
+		bufferSize:  DefaultBufferSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var serverOpts []grpc.ServerOption
+	if o.defaultOpts {
+		serverOpts = append(serverOpts, run.DefaultServerOptions(o.logger)...)
+	}
+	serverOpts = append(serverOpts, o.serverOpts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		GRPCServer: grpc.NewServer(serverOpts...),
+		Listener:   bufconn.Listen(o.bufferSize),
+		cancel:     cancel,
+	}
+	t.Cleanup(s.Close)
+
+	if register != nil {
+		register(s.GRPCServer)
+	}
+	if o.healthRegistry != nil {
+		s.Health = health.NewServer()
+		healthpb.RegisterHealthServer(s.GRPCServer, s.Health)
+		var services []string
+		for name := range s.GRPCServer.GetServiceInfo() {
+			services = append(services, name)
+		}
+		o.healthRegistry.Attach(s.Health, services)
+	}
+	go s.GRPCServer.Serve(s.Listener)
+
+	if o.register != nil {
+		gatewayOpts := []run.ServerOption{
+			run.WithGRPCServer(s.GRPCServer),
+			run.WithAddress(Address, ""),
+			run.WithGateway(o.register),
+			run.WithDialOptions(s.DialOptions()...),
+			run.WithLogger(o.logger),
+		}
+		if o.healthRegistry != nil {
+			gatewayOpts = append(gatewayOpts, run.WithHealthRegistry(o.healthRegistry))
+		}
+		gw := run.NewServer(append(gatewayOpts, o.gatewayOpts...)...)
+		handler, err := gw.HTTPHandler(ctx)
+		if err != nil {
+			t.Fatalf("grpctest: gateway: %v", err)
+		}
+		s.Gateway = httptest.NewServer(handler)
+	}
+	return s
+}
+
+// DialOptions returns the options dialing the server, add them to the options
+// of grpc.Dial or to grcp.ClientOption.DialOptions
+func (s *Server) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.Listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+}
+
+// Dial returns new connection to the server, closed with the server
+func (s *Server) Dial(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	conn, err := grpc.Dial(Address, append(s.DialOptions(), opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+	return conn, nil
+}
+
+// Conn returns the connection shared by the clients of the server
+func (s *Server) Conn() *grpc.ClientConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		// dialing is lazy, it only fails on invalid options
+		conn, err := grpc.Dial(Address, s.DialOptions()...)
+		if err != nil {
+			panic(err)
+		}
+		s.conn = conn
+		s.conns = append(s.conns, conn)
+	}
+	return s.conn
+}
+
+// ClientOption returns option with the dial options of the server added, e.g. for
+//
+//	factory := grcp.EndpointFactoryWithOption(makeEndpoint, nil, srv.ClientOption(option), tracer, logger)
+//	endpoint, closer, err := factory(grpctest.Address)
+func (s *Server) ClientOption(option run.ClientOption) run.ClientOption {
+	option.DialOptions = append(append([]grpc.DialOption{}, option.DialOptions...), s.DialOptions()...)
+	return option
+}
+
+// Close closes the connections, the gateway and stops the server
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		if s.Gateway != nil {
+			s.Gateway.Close()
+		}
+		s.mu.Lock()
+		for _, conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		s.GRPCServer.Stop()
+	})
+}
@@ -0,0 +1,111 @@
+package grpctest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	run "github.com/uninus-opensource/uninus-go-architect-common/grcp"
+	"github.com/uninus-opensource/uninus-go-architect-common/healthcheck"
+)
+
+// registerHealthGateway serves GET /v1/health?service= with the grpc health service
+func registerHealthGateway(ctx context.Context, mux *runtime.ServeMux, address string, opts []grpc.DialOption) error {
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	client := healthpb.NewHealthClient(conn)
+	pattern := runtime.MustPattern(runtime.NewPattern(1, []int{2, 0, 2, 1}, []string{"v1", "health"}, ""))
+	mux.Handle(http.MethodGet, pattern, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r)
+		if err == nil {
+			var resp *healthpb.HealthCheckResponse
+			resp, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: r.URL.Query().Get("service")})
+			if err == nil {
+				runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, resp)
+				return
+			}
+		}
+		runtime.HTTPError(ctx, mux, outbound, w, r, err)
+	})
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	var downstreamErr error
+	registry := healthcheck.NewRegistry(time.Second)
+	registry.Register("downstream", healthcheck.CheckerFunc(func(ctx context.Context) error { return downstreamErr }))
+
+	srv := NewServer(t, nil,
+		WithHealthRegistry(registry),
+		WithGateway(registerHealthGateway, run.WithCORSPolicy(run.AllowedOriginsCORSPolicy("https://app.uninus.id"))),
+	)
+
+	client := healthpb.NewHealthClient(srv.Conn())
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+	r, err := http.NewRequest(http.MethodGet, srv.Gateway.URL+"/v1/health", nil)
+	require.NoError(t, err)
+	r.Header.Set("Origin", "https://app.uninus.id")
+	httpResp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	httpResp.Body.Close()
+	require.Equal(t, http.StatusOK, httpResp.StatusCode)
+	require.Equal(t, "https://app.uninus.id", httpResp.Header.Get("Access-Control-Allow-Origin"))
+	require.NotEmpty(t, httpResp.Header.Get(run.RequestIDHeader))
+
+	httpResp, err = http.Get(srv.Gateway.URL + "/v1/health?service=unknown")
+	require.NoError(t, err)
+	httpResp.Body.Close()
+	require.Equal(t, http.StatusNotFound, httpResp.StatusCode)
+
+	downstreamErr = errors.New("connection refused")
+	registry.CheckReadiness(context.Background())
+	httpResp, err = http.Get(srv.Gateway.URL + healthcheck.ReadyPath)
+	require.NoError(t, err)
+	httpResp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, httpResp.StatusCode)
+}
+
+func TestServerEndpointFactory(t *testing.T) {
+	srv := NewServer(t, nil, WithHealthRegistry(healthcheck.NewRegistry(time.Second)))
+
+	makeEndpoint := func(conn *grpc.ClientConn, _ time.Duration, _ stdopentracing.Tracer, _ log.Logger) endpoint.Endpoint {
+		client := healthpb.NewHealthClient(conn)
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			return client.Check(ctx, request.(*healthpb.HealthCheckRequest))
+		}
+	}
+	factory := run.EndpointFactoryWithOption(makeEndpoint, nil, srv.ClientOption(run.ClientOption{Timeout: time.Second}),
+		stdopentracing.NoopTracer{}, log.NewNopLogger())
+	e, closer, err := factory(Address)
+	require.NoError(t, err)
+	defer closer.Close()
+
+	resp, err := e(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.(*healthpb.HealthCheckResponse).GetStatus())
+
+	_, err = e(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,216 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/log"
+	middle "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+	uerrors "github.com/uninus-opensource/uninus-go-architect-common/errors"
+	util "github.com/uninus-opensource/uninus-go-architect-common/log"
+	"github.com/uninus-opensource/uninus-go-architect-common/microservice"
+)
+
+const (
+	// CodePeerUnauthenticated is the application error code of calls without a client certificate
+	CodePeerUnauthenticated = "PEER_UNAUTHENTICATED"
+	// CodePeerNotAllowed is the application error code of peers not allowed to call a method
+	CodePeerNotAllowed = "PEER_NOT_ALLOWED"
+)
+
+var (
+	// ErrPeerUnauthenticated is returned when the caller sent no verified client certificate
+	ErrPeerUnauthenticated error = uerrors.NewAppError(codes.Unauthenticated, CodePeerUnauthenticated, "Client certificate required")
+	// ErrPeerNotAllowed is returned when the caller identity is not allowed to call the method
+	ErrPeerNotAllowed error = uerrors.NewAppError(codes.PermissionDenied, CodePeerNotAllowed, "Peer is not allowed")
+)
+
+// PeerIdentityFromCertificate returns the identity named by the SAN uris, dns names and CN of cert
+func PeerIdentityFromCertificate(cert *x509.Certificate) microservice.PeerIdentity {
+	identity := microservice.PeerIdentity{
+		DNSNames:   cert.DNSNames,
+		CommonName: cert.Subject.CommonName,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+		if identity.SPIFFEID == "" && uri.Scheme == "spiffe" {
+			identity.SPIFFEID = uri.String()
+		}
+	}
+	return identity
+}
+
+// peerIdentityFromTLS returns the identity of the client certificate verified in the handshake,
+// certificates not verified by the tls.Config of the connection are not trusted
+func peerIdentityFromTLS(state *tls.ConnectionState) (microservice.PeerIdentity, bool) {
+	if state == nil {
+		return microservice.PeerIdentity{}, false
+	}
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		return PeerIdentityFromCertificate(state.VerifiedChains[0][0]), true
+	}
+	return microservice.PeerIdentity{}, false
+}
+
+// PeerIdentityFromContext returns the identity of the grpc peer of ctx,
+// false when the peer did not send a client certificate.
+// Servers must verify client certificates, see TLSCredentialFromFile and CertProvider.
+func PeerIdentityFromContext(ctx context.Context) (microservice.PeerIdentity, bool) {
+	if identity, ok := microservice.GetPeerIdentityByContext(ctx); ok {
+		return identity, true
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return microservice.PeerIdentity{}, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return microservice.PeerIdentity{}, false
+	}
+	return peerIdentityFromTLS(&info.State)
+}
+
+// IdentityAuthorizer reports whether identity may call method,
+// a grpc full method or a http path
+type IdentityAuthorizer interface {
+	Allowed(method string, identity microservice.PeerIdentity) bool
+}
+
+// IdentityPolicy maps methods to the identities allowed to call them.
+// Methods and identities are path.Match patterns, e.g. "/uninus.auth.Auth/*"
+// and "spiffe://uninus.id/ns/prod/sa/*", "*" alone matches everything.
+// Methods without a matching pattern can not be called, the gateway dials
+// the grpc server with the server certificate so its own identity must be allowed.
+type IdentityPolicy map[string][]string
+
+// Allowed reports whether one of the names of identity is allowed for the
+// most specific pattern matching method
+func (p IdentityPolicy) Allowed(method string, identity microservice.PeerIdentity) bool {
+	patterns, _ := lookupMethod(p, method)
+	names := identity.Names()
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return len(names) > 0
+		}
+		for _, name := range names {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ConfigIdentityPolicy returns policy read from the json of config.MTLSAllowlist,
+// e.g. {"/uninus.auth.Auth/*": ["spiffe://uninus.id/ns/prod/sa/gateway"]}
+func ConfigIdentityPolicy() (IdentityPolicy, error) {
+	policy := IdentityPolicy{}
+	v := strings.TrimSpace(cfg.Get(cfg.MTLSAllowlist, ""))
+	if v == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(v), &policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+type configIdentityAuthorizer struct {
+	current atomic.Value
+}
+
+func (a *configIdentityAuthorizer) Allowed(method string, identity microservice.PeerIdentity) bool {
+	return a.current.Load().(IdentityPolicy).Allowed(method, identity)
+}
+
+// ConfigIdentityAuthorizer returns authorizer using ConfigIdentityPolicy,
+// the policy is reloaded every time config.AppConfig changes.
+// An invalid policy is logged and the previous one is kept.
+func ConfigIdentityAuthorizer(logger log.Logger) IdentityAuthorizer {
+	a := &configIdentityAuthorizer{}
+	load := func() {
+		policy, err := ConfigIdentityPolicy()
+		if err != nil {
+			logger.Log(util.LogError, "invalid "+cfg.MTLSAllowlist+": "+err.Error())
+			if a.current.Load() != nil {
+				return
+			}
+			policy = IdentityPolicy{}
+		}
+		a.current.Store(policy)
+	}
+	load()
+	cfg.AppConfig.AddChangeNotificationFunc(load)
+	return a
+}
+
+// authorizeIdentity returns ctx with the identity of the caller when it may call method
+func authorizeIdentity(ctx context.Context, identity microservice.PeerIdentity, ok bool, method string, authorizer IdentityAuthorizer) (context.Context, error) {
+	if !ok {
+		return ctx, ErrPeerUnauthenticated
+	}
+	if !authorizer.Allowed(method, identity) {
+		return ctx, ErrPeerNotAllowed
+	}
+	return microservice.SetPeerIdentityToContext(ctx, identity), nil
+}
+
+// UnaryServerIdentityInterceptor returns grpc interceptor setting the peer identity to
+// the context, calls of identities not allowed by authorizer are rejected
+func UnaryServerIdentityInterceptor(authorizer IdentityAuthorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, ok := PeerIdentityFromContext(ctx)
+		ctx, err := authorizeIdentity(ctx, identity, ok, info.FullMethod, authorizer)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerIdentityInterceptor returns grpc interceptor setting the peer identity to
+// the stream context, streams of identities not allowed by authorizer are rejected
+func StreamServerIdentityInterceptor(authorizer IdentityAuthorizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		identity, ok := PeerIdentityFromContext(stream.Context())
+		ctx, err := authorizeIdentity(stream.Context(), identity, ok, info.FullMethod, authorizer)
+		if err != nil {
+			return err
+		}
+		wrapped := middle.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+// IdentityMiddleware returns http middleware setting the identity of the client certificate
+// to the request context, requests of identities not allowed by authorizer for
+// the request path are answered with 401 or 403
+func IdentityMiddleware(authorizer IdentityAuthorizer) HTTPMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := peerIdentityFromTLS(r.TLS)
+			ctx, err := authorizeIdentity(r.Context(), identity, ok, r.URL.Path, authorizer)
+			switch err {
+			case nil:
+				handler.ServeHTTP(w, r.WithContext(ctx))
+			case ErrPeerUnauthenticated:
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			default:
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/microservice"
+)
+
+func TestIdentityPolicyAllowed(t *testing.T) {
+	policy := IdentityPolicy{
+		"/uninus.auth.Auth/*":     {"spiffe://uninus.id/ns/prod/sa/*"},
+		"/uninus.auth.Auth/Admin": {"spiffe://uninus.id/ns/prod/sa/admin"},
+		"*":                       {"gateway.uninus.id"},
+	}
+	auth := microservice.PeerIdentity{URIs: []string{"spiffe://uninus.id/ns/prod/sa/auth"}}
+	gateway := microservice.PeerIdentity{DNSNames: []string{"gateway.uninus.id"}}
+
+	require.True(t, policy.Allowed("/uninus.auth.Auth/Login", auth))
+	require.False(t, policy.Allowed("/uninus.auth.Auth/Admin", auth))
+	require.False(t, policy.Allowed("/uninus.user.User/Get", auth))
+	require.True(t, policy.Allowed("/uninus.user.User/Get", gateway))
+	require.False(t, policy.Allowed("/uninus.auth.Auth/Login", gateway))
+	require.False(t, IdentityPolicy{}.Allowed("/uninus.auth.Auth/Login", auth))
+}
+
+func TestIdentityInterceptors(t *testing.T) {
+	uri, _ := url.Parse("spiffe://uninus.id/ns/prod/sa/auth")
+	cert := &x509.Certificate{URIs: []*url.URL{uri}, DNSNames: []string{"auth.uninus.id"}}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	policy := IdentityPolicy{"/uninus.auth.Auth/*": {"spiffe://uninus.id/ns/prod/sa/auth"}}
+
+	var identity microservice.PeerIdentity
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, _ = microservice.GetPeerIdentityByContext(ctx)
+		return nil, nil
+	}
+	interceptor := UnaryServerIdentityInterceptor(policy)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/uninus.auth.Auth/Login"}, handler)
+	require.NoError(t, err)
+	require.Equal(t, "spiffe://uninus.id/ns/prod/sa/auth", identity.SPIFFEID)
+	require.Equal(t, []string{"auth.uninus.id"}, identity.DNSNames)
+
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/uninus.user.User/Get"}, handler)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/uninus.auth.Auth/Login"}, handler)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	h := IdentityMiddleware(IdentityPolicy{"/v1/auth/*": {"auth.uninus.id"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/v1/auth/login", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req.TLS = &state
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestCertProviderServerIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, &x509.Certificate{SerialNumber: big.NewInt(2), DNSNames: []string{"localhost"}})
+	provider, err := newCertProvider(func() ([]byte, []byte, []byte, error) { return ca.pem, certPEM, keyPEM, nil }, log.NewNopLogger())
+	require.NoError(t, err)
+	defer provider.Close()
+
+	var identity microservice.PeerIdentity
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = peerIdentityFromTLS(r.TLS)
+	}))
+	srv.TLS = provider.ServerTLSConfig(true)
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(cert tls.Certificate) error {
+		config := provider.ClientTLSConfig()
+		config.ServerName = "localhost"
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &cert, nil }
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	require.NoError(t, get(cert))
+	require.Equal(t, []string{"localhost"}, identity.DNSNames)
+
+	// signed by another ca
+	otherPEM, otherKey := newTestCA(t).issue(t, &x509.Certificate{SerialNumber: big.NewInt(3)})
+	other, err := tls.X509KeyPair(otherPEM, otherKey)
+	require.NoError(t, err)
+	require.Error(t, get(other))
+
+	// not usable for client auth
+	serverPEM, serverKey := ca.issue(t, &x509.Certificate{SerialNumber: big.NewInt(4), ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	server, err := tls.X509KeyPair(serverPEM, serverKey)
+	require.NoError(t, err)
+	require.Error(t, get(server))
+	block, _ := pem.Decode(serverPEM)
+	require.Error(t, provider.VerifyPeerCertificate([][]byte{block.Bytes}, nil))
+
+	// certificates not verified by the handshake are not trusted
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	_, ok := peerIdentityFromTLS(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}})
+	require.False(t, ok)
+}
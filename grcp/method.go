@@ -0,0 +1,19 @@
+package grpc
+
+import "path"
+
+// lookupMethod returns the value of method in m, or of the longest path.Match
+// pattern matching method, "*" alone matches every method
+func lookupMethod[V any](m map[string]V, method string) (V, bool) {
+	if v, ok := m[method]; ok {
+		return v, true
+	}
+	var v V
+	best := -1
+	for pattern, pv := range m {
+		if matched, _ := path.Match(pattern, method); (matched || pattern == "*") && len(pattern) > best {
+			v, best = pv, len(pattern)
+		}
+	}
+	return v, best >= 0
+}
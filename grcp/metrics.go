@@ -0,0 +1,203 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sony/gobreaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/flags"
+)
+
+// MetricsPath is the path of the prometheus handler on the debug address
+const MetricsPath = "/metrics"
+
+var (
+	grpcServerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "grpc_server",
+		Name:      "requests_total",
+		Help:      "Number of grpc calls handled by the server.",
+	}, []string{"method", "code"})
+	grpcServerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "grpc_server",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of grpc calls handled by the server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+	grpcServerInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "grpc_server",
+		Name:      "in_flight_requests",
+		Help:      "Number of grpc calls being handled by the server.",
+	}, []string{"method"})
+
+	grpcClientRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "grpc_client",
+		Name:      "requests_total",
+		Help:      "Number of grpc calls made to other services.",
+	}, []string{"method", "code"})
+	grpcClientDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "grpc_client",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of grpc calls made to other services.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+	grpcClientInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "grpc_client",
+		Name:      "in_flight_requests",
+		Help:      "Number of grpc calls to other services waiting for a response.",
+	}, []string{"method"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of http requests handled by the gateway.",
+	}, []string{"method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of http requests handled by the gateway.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "http",
+		Name:      "in_flight_requests",
+		Help:      "Number of http requests being handled by the gateway.",
+	})
+
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: flags.UNINUS_PROMETHEUS_NAMESPACE,
+		Subsystem: "circuit_breaker",
+		Name:      "state",
+		Help:      "State of the circuit breaker, 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		grpcServerRequests, grpcServerDuration, grpcServerInFlight,
+		grpcClientRequests, grpcClientDuration, grpcClientInFlight,
+		httpRequests, httpDuration, httpInFlight,
+		circuitBreakerState,
+	)
+}
+
+// MetricsHandler returns handler exposing the metrics in prometheus format
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+func observe(requests *prometheus.CounterVec, duration *prometheus.HistogramVec, method string, err error, start time.Time) {
+	code := status.Code(err).String()
+	requests.WithLabelValues(method, code).Inc()
+	duration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+}
+
+// UnaryServerMetricsInterceptor records count, latency and in-flight grpc calls by method and code
+func UnaryServerMetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		inFlight := grpcServerInFlight.WithLabelValues(info.FullMethod)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observe(grpcServerRequests, grpcServerDuration, info.FullMethod, err, start)
+		return resp, err
+	}
+}
+
+// StreamServerMetricsInterceptor is UnaryServerMetricsInterceptor for streams,
+// the latency of a stream is the time until the handler returns
+func StreamServerMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		inFlight := grpcServerInFlight.WithLabelValues(info.FullMethod)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		err := handler(srv, stream)
+		observe(grpcServerRequests, grpcServerDuration, info.FullMethod, err, start)
+		return err
+	}
+}
+
+// UnaryClientMetricsInterceptor records count, latency and in-flight grpc calls
+// made to other services by method and code
+func UnaryClientMetricsInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		inFlight := grpcClientInFlight.WithLabelValues(method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		observe(grpcClientRequests, grpcClientDuration, method, err, start)
+		return err
+	}
+}
+
+// StreamClientMetricsInterceptor records the grpc streams opened to other services,
+// the latency of a stream is the time to open it
+func StreamClientMetricsInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		observe(grpcClientRequests, grpcClientDuration, method, err, start)
+		return stream, err
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush keeps streamed gateway responses working through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// MetricsMiddleware records count, latency and in-flight http requests by method and status code
+func MetricsMiddleware() HTTPMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httpInFlight.Inc()
+			defer httpInFlight.Dec()
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+			handler.ServeHTTP(rec, r)
+
+			code := strconv.Itoa(rec.code)
+			httpRequests.WithLabelValues(r.Method, code).Inc()
+			httpDuration.WithLabelValues(r.Method, code).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// setCircuitBreakerState records the state of the named circuit breaker
+func setCircuitBreakerState(name string, state gobreaker.State) {
+	circuitBreakerState.WithLabelValues(name).Set(float64(state))
+}
@@ -0,0 +1,35 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	handler := MetricsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}
+	UnaryServerMetricsInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	DefaultOnStateChange("test", gobreaker.StateClosed, gobreaker.StateOpen)
+
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", MetricsPath, nil))
+	body := w.Body.String()
+	require.Contains(t, body, `UninusService_http_requests_total{code="418",method="POST"} 1`)
+	require.Contains(t, body, `UninusService_grpc_server_requests_total{code="NotFound",method="/test.Service/Call"} 1`)
+	require.Contains(t, body, `UninusService_grpc_server_in_flight_requests{method="/test.Service/Call"} 0`)
+	require.Contains(t, body, `UninusService_circuit_breaker_state{name="test"} 2`)
+}
@@ -0,0 +1,401 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+	util "github.com/uninus-opensource/uninus-go-architect-common/log"
+	"github.com/uninus-opensource/uninus-go-architect-common/microservice"
+)
+
+// DefaultMaxLoggedBodySize is the max size of logged bodies
+const DefaultMaxLoggedBodySize = 4096
+
+// PayloadLogPolicy configures the logging of calls and their payloads
+type PayloadLogPolicy struct {
+	// Disabled turns the logging of calls off
+	Disabled bool `json:"disabled"`
+	// Bodies enables the logging of request and response bodies
+	Bodies bool `json:"bodies"`
+	// SampleRate is the fraction of calls whose bodies are logged, 0 logs them all
+	SampleRate float64 `json:"sample_rate"`
+	// MaxBodySize truncates logged bodies, 0 uses DefaultMaxLoggedBodySize.
+	// Truncated json bodies can not be redacted and are logged as log.RedactedValue.
+	MaxBodySize int `json:"max_body_size"`
+	// Skip are the grpc methods or http paths not logged, path.Match patterns like DeadlinePolicy
+	Skip []string `json:"skip"`
+	// Redact is added to the rules of log.DefaultRedactor
+	Redact util.Redactor `json:"redact"`
+}
+
+// DefaultPayloadLogPolicy returns policy logging calls without their bodies,
+// the health, metrics and root paths are skipped
+func DefaultPayloadLogPolicy() PayloadLogPolicy {
+	return PayloadLogPolicy{
+		Skip: []string{"/", "/healthz/*", "/metrics", "/grpc.health.v1.Health/*"},
+	}
+}
+
+// ConfigPayloadLogPolicy returns DefaultPayloadLogPolicy overridden by the json of config.PayloadLogging,
+// e.g. {"bodies": true, "sample_rate": 0.1, "redact": {"json_paths": ["user.pin"]}}
+func ConfigPayloadLogPolicy() (PayloadLogPolicy, error) {
+	policy := DefaultPayloadLogPolicy()
+	v := strings.TrimSpace(cfg.Get(cfg.PayloadLogging, ""))
+	if v == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(v), &policy); err != nil {
+		return PayloadLogPolicy{}, err
+	}
+	return policy, nil
+}
+
+type payloadPolicy struct {
+	PayloadLogPolicy
+	skip     map[string]bool
+	redactor util.Redactor
+}
+
+func (p PayloadLogPolicy) compile() *payloadPolicy {
+	c := &payloadPolicy{
+		PayloadLogPolicy: p,
+		skip:             map[string]bool{},
+		redactor:         util.DefaultRedactor.Merge(p.Redact),
+	}
+	for _, pattern := range p.Skip {
+		c.skip[pattern] = true
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = DefaultMaxLoggedBodySize
+	}
+	return c
+}
+
+// sampled reports whether the bodies of a call are logged
+func (p *payloadPolicy) sampled() bool {
+	return p.Bodies && (p.SampleRate <= 0 || p.SampleRate >= 1 || rand.Float64() < p.SampleRate)
+}
+
+// body returns the redacted body, truncated to MaxBodySize
+func (p *payloadPolicy) body(contentType string, body []byte) string {
+	if len(body) > p.MaxBodySize {
+		body = body[:p.MaxBodySize]
+	}
+	return string(p.redactor.RedactBody(contentType, body))
+}
+
+// message returns the redacted json of the grpc message m
+func (p *payloadPolicy) message(m interface{}) string {
+	if m == nil {
+		return ""
+	}
+	var body []byte
+	var err error
+	if pm, ok := m.(proto.Message); ok {
+		body, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(proto.MessageV2(pm))
+	} else {
+		body, err = json.Marshal(m)
+	}
+	if err != nil {
+		return util.RedactedValue
+	}
+	return p.body("application/json", body)
+}
+
+// messageSize returns the wire size of the grpc message m
+func messageSize(m interface{}) int {
+	if pm, ok := m.(proto.Message); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
+
+// PayloadLogger logs the method, duration, status, sizes and sampled bodies of calls
+type PayloadLogger struct {
+	logger log.Logger
+	policy *atomic.Value
+}
+
+// NewPayloadLogger returns payload logger using policy
+func NewPayloadLogger(logger log.Logger, policy PayloadLogPolicy) *PayloadLogger {
+	l := &PayloadLogger{logger: logger, policy: &atomic.Value{}}
+	l.SetPolicy(policy)
+	return l
+}
+
+var (
+	configPayloadOnce   sync.Once
+	configPayloadPolicy atomic.Value
+)
+
+// ConfigPayloadLogger returns payload logger using ConfigPayloadLogPolicy,
+// the policy is reloaded every time config.AppConfig changes.
+// The policy is compiled once per process and shared by the loggers of ConfigPayloadLogger,
+// an invalid policy is logged by the logger of the first call and the previous one is kept.
+func ConfigPayloadLogger(logger log.Logger) *PayloadLogger {
+	configPayloadOnce.Do(func() {
+		load := func() {
+			policy, err := ConfigPayloadLogPolicy()
+			if err != nil {
+				logger.Log(util.LogError, "invalid "+cfg.PayloadLogging+": "+err.Error())
+				if configPayloadPolicy.Load() != nil {
+					return
+				}
+				policy = DefaultPayloadLogPolicy()
+			}
+			configPayloadPolicy.Store(policy.compile())
+		}
+		load()
+		cfg.AppConfig.AddChangeNotificationFunc(load)
+	})
+	return &PayloadLogger{logger: logger, policy: &configPayloadPolicy}
+}
+
+// SetPolicy replaces the policy of l, and of every logger of ConfigPayloadLogger when l is one of them
+func (l *PayloadLogger) SetPolicy(policy PayloadLogPolicy) {
+	l.policy.Store(policy.compile())
+}
+
+// policyFor returns the policy of method, false when method is not logged
+func (l *PayloadLogger) policyFor(method string) (*payloadPolicy, bool) {
+	p := l.policy.Load().(*payloadPolicy)
+	if p.Disabled {
+		return nil, false
+	}
+	if skip, _ := lookupMethod(p.skip, method); skip {
+		return nil, false
+	}
+	return p, true
+}
+
+// log logs a call of method answered with the http status code, server errors are
+// logged as errors and client errors as warnings
+func (l *PayloadLogger) log(ctx context.Context, transport, method string, code int, status string, start time.Time, keyvals ...interface{}) {
+	level := util.LogInfo
+	switch {
+	case code >= http.StatusInternalServerError:
+		level = util.LogError
+	case code >= http.StatusBadRequest:
+		level = util.LogWarning
+	}
+	l.logger.Log(append([]interface{}{
+		level, "payload",
+		"transport", transport,
+		util.LogMethod, method,
+		"request_id", microservice.GetRequestIDByContext(ctx),
+		"status", status,
+		util.LogTook, time.Since(start).String(),
+	}, keyvals...)...)
+}
+
+// UnaryServerPayloadInterceptor returns grpc interceptor logging calls through l
+func UnaryServerPayloadInterceptor(l *PayloadLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, ok := l.policyFor(info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		keyvals := []interface{}{
+			"request_size", messageSize(req),
+			"response_size", messageSize(resp),
+			"metadata", fmt.Sprintf("%+v", p.redactor.RedactMetadata(md)),
+		}
+		if p.sampled() {
+			keyvals = append(keyvals, "request", p.message(req), "response", p.message(resp))
+		}
+		code := status.Code(err)
+		l.log(ctx, "grpc", info.FullMethod, runtime.HTTPStatusFromCode(code), code.String(), start, keyvals...)
+		return resp, err
+	}
+}
+
+// StreamServerPayloadInterceptor returns grpc interceptor logging streams through l,
+// the first request and response of sampled streams are logged
+func StreamServerPayloadInterceptor(l *PayloadLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		p, ok := l.policyFor(info.FullMethod)
+		if !ok {
+			return handler(srv, stream)
+		}
+		start := time.Now()
+		ps := &payloadServerStream{ServerStream: stream, policy: p, sampled: p.sampled()}
+		err := handler(srv, ps)
+
+		ctx := stream.Context()
+		md, _ := metadata.FromIncomingContext(ctx)
+		keyvals := []interface{}{
+			"requests", ps.received,
+			"responses", ps.sent,
+			"request_size", ps.receivedSize,
+			"response_size", ps.sentSize,
+			"metadata", fmt.Sprintf("%+v", p.redactor.RedactMetadata(md)),
+		}
+		if ps.sampled {
+			keyvals = append(keyvals, "request", ps.request, "response", ps.response)
+		}
+		code := status.Code(err)
+		l.log(ctx, "grpc", info.FullMethod, runtime.HTTPStatusFromCode(code), code.String(), start, keyvals...)
+		return err
+	}
+}
+
+// PayloadServerOptions returns grpc server options logging calls through l,
+// the calls are logged after the interceptors of DefaultServerOptions, e.g.
+//
+//	opts := append(DefaultServerOptions(logger), PayloadServerOptions(ConfigPayloadLogger(logger))...)
+func PayloadServerOptions(l *PayloadLogger) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerPayloadInterceptor(l)),
+		grpc.ChainStreamInterceptor(StreamServerPayloadInterceptor(l)),
+	}
+}
+
+// payloadServerStream counts the messages of a stream, keeping the first ones of sampled streams
+type payloadServerStream struct {
+	grpc.ServerStream
+	policy                 *payloadPolicy
+	sampled                bool
+	mu                     sync.Mutex
+	received, sent         int
+	receivedSize, sentSize int
+	request, response      string
+}
+
+func (s *payloadServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received++
+	s.receivedSize += messageSize(m)
+	if s.sampled && s.received == 1 {
+		s.request = s.policy.message(m)
+	}
+	return nil
+}
+
+func (s *payloadServerStream) SendMsg(m interface{}) error {
+	s.mu.Lock()
+	s.sent++
+	s.sentSize += messageSize(m)
+	if s.sampled && s.sent == 1 {
+		s.response = s.policy.message(m)
+	}
+	s.mu.Unlock()
+	return s.ServerStream.SendMsg(m)
+}
+
+// payloadRecorder records the status, size and first bytes of http responses
+type payloadRecorder struct {
+	statusRecorder
+	size  int
+	body  *bytes.Buffer
+	limit int
+}
+
+func (r *payloadRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	if r.body != nil {
+		// one more byte than logged so truncated bodies are detected
+		if left := r.limit + 1 - r.body.Len(); left > 0 {
+			if left > n {
+				left = n
+			}
+			r.body.Write(b[:left])
+		}
+	}
+	return n, err
+}
+
+// countingBody counts the bytes of the request body read by the handler
+type countingBody struct {
+	io.Reader
+	io.Closer
+	n int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.n += n
+	return n, err
+}
+
+// PayloadLogMiddleware returns http middleware logging requests through l
+func PayloadLogMiddleware(l *PayloadLogger) HTTPMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := l.policyFor(r.URL.Path)
+			if !ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			sampled := p.sampled()
+
+			var reqBody []byte
+			var body *countingBody
+			if r.Body != nil && r.Body != http.NoBody {
+				var reader io.Reader = r.Body
+				if sampled {
+					// the read prefix is given back to the handler
+					reqBody, _ = io.ReadAll(io.LimitReader(r.Body, int64(p.MaxBodySize)+1))
+					reader = io.MultiReader(bytes.NewReader(reqBody), r.Body)
+				}
+				body = &countingBody{Reader: reader, Closer: r.Body}
+				r.Body = body
+			}
+
+			rec := &payloadRecorder{statusRecorder: statusRecorder{ResponseWriter: w, code: http.StatusOK}, limit: p.MaxBodySize}
+			if sampled {
+				rec.body = &bytes.Buffer{}
+			}
+			handler.ServeHTTP(rec, r)
+
+			reqSize := int(r.ContentLength)
+			if body != nil && body.n > reqSize {
+				reqSize = body.n
+			}
+			if reqSize < 0 {
+				reqSize = 0
+			}
+			keyvals := []interface{}{
+				"request_size", reqSize,
+				"response_size", rec.size,
+				"ip", util.GetIPClient(r),
+				"header", fmt.Sprintf("%+v", p.redactor.RedactHeader(r.Header)),
+			}
+			if sampled {
+				keyvals = append(keyvals,
+					"request", p.body(r.Header.Get("Content-Type"), reqBody),
+					"response", p.body(rec.Header().Get("Content-Type"), rec.body.Bytes()),
+				)
+			}
+			l.log(r.Context(), "http", r.Method+" "+r.URL.Path, rec.code, http.StatusText(rec.code), start, keyvals...)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	util "github.com/uninus-opensource/uninus-go-architect-common/log"
+)
+
+// recordLogger returns logger keeping the key values of the last logged line
+func recordLogger() (log.Logger, map[string]string) {
+	last := map[string]string{}
+	return log.LoggerFunc(func(keyvals ...interface{}) error {
+		for k := range last {
+			delete(last, k)
+		}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			last[fmt.Sprint(keyvals[i])] = fmt.Sprint(keyvals[i+1])
+		}
+		return nil
+	}), last
+}
+
+func TestPayloadLogMiddleware(t *testing.T) {
+	logger, last := recordLogger()
+	l := NewPayloadLogger(logger, PayloadLogPolicy{Bodies: true, Skip: []string{"/healthz/*"}})
+
+	var received []byte
+	handler := PayloadLogMiddleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access_token":"t"}`))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/token/auth", strings.NewReader(`{"user_id":"u","user_secret":"s"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Equal(t, `{"user_id":"u","user_secret":"s"}`, string(received))
+	require.Equal(t, "payload", last[util.LogWarning])
+	require.Equal(t, "POST /token/auth", last[util.LogMethod])
+	require.Equal(t, "33", last["request_size"])
+	require.Equal(t, "20", last["response_size"])
+	require.JSONEq(t, `{"user_id":"u","user_secret":"[REDACTED]"}`, last["request"])
+	require.JSONEq(t, `{"access_token":"[REDACTED]"}`, last["response"])
+	require.NotContains(t, last["header"], "secret")
+
+	delete(last, util.LogMethod)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz/live", nil))
+	require.Empty(t, last[util.LogMethod])
+}
+
+func TestUnaryServerPayloadInterceptor(t *testing.T) {
+	logger, last := recordLogger()
+	l := NewPayloadLogger(logger, PayloadLogPolicy{Bodies: true, Redact: util.Redactor{Fields: []string{"nik"}}})
+	interceptor := UnaryServerPayloadInterceptor(l)
+
+	req, err := structpb.NewStruct(map[string]interface{}{"nik": "3201", "name": "a"})
+	require.NoError(t, err)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "failed")
+	}
+	_, err = interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}, handler)
+	require.Error(t, err)
+
+	require.Equal(t, "payload", last[util.LogError])
+	require.Equal(t, "/test.Service/Call", last[util.LogMethod])
+	require.Equal(t, "Internal", last["status"])
+	require.JSONEq(t, `{"nik":"[REDACTED]","name":"a"}`, last["request"])
+	require.NotContains(t, last["metadata"], "secret")
+
+	l.SetPolicy(PayloadLogPolicy{Disabled: true})
+	delete(last, util.LogMethod)
+	_, _ = interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}, handler)
+	require.Empty(t, last[util.LogMethod])
+}
+
+func TestConfigPayloadLoggerSharedPolicy(t *testing.T) {
+	l1, _ := recordLogger()
+	l2, _ := recordLogger()
+	p1, p2 := ConfigPayloadLogger(l1), ConfigPayloadLogger(l2)
+	require.Same(t, p1.policy, p2.policy)
+	_, ok := p2.policyFor("/test.Service/Call")
+	require.True(t, ok)
+	require.Len(t, PayloadServerOptions(p1), 2)
+}
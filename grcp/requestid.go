@@ -0,0 +1,141 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+
+	middle "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/microservice"
+	"github.com/uninus-opensource/uninus-go-architect-common/uuid"
+)
+
+const (
+	// RequestIDHeader is the header and metadata key of the request id
+	RequestIDHeader = "transaction.id"
+	// TraceIDHeader is the header and metadata key of the trace id
+	TraceIDHeader = "trace.id"
+)
+
+// newID returns new random id, empty if no random data is available
+func newID() string {
+	id, err := uuid.New()
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+// requestIDs returns the ids of the request, creating the missing ones.
+// The trace id falls back to the request id for callers sending only one of them.
+func requestIDs(requestID, traceID string) (string, string) {
+	if requestID == "" {
+		requestID = newID()
+	}
+	if traceID == "" {
+		traceID = requestID
+	}
+	return requestID, traceID
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// withRequestIDs stores the ids in ctx, they are also set into the incoming
+// metadata so log.GetRequestID and log.GetTraceID return the same ids.
+func withRequestIDs(ctx context.Context, requestID, traceID string) context.Context {
+	ctx = microservice.SetRequestIDToContext(ctx, requestID)
+	ctx = microservice.SetTraceIDToContext(ctx, traceID)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	md.Set(RequestIDHeader, requestID)
+	md.Set(TraceIDHeader, traceID)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func serverRequestIDs(ctx context.Context) (context.Context, metadata.MD) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID, traceID := requestIDs(firstValue(md, RequestIDHeader), firstValue(md, TraceIDHeader))
+	return withRequestIDs(ctx, requestID, traceID), metadata.Pairs(RequestIDHeader, requestID, TraceIDHeader, traceID)
+}
+
+// UnaryServerRequestIDInterceptor reads the request and trace ids from the
+// incoming metadata, or creates them, and sends them back as response header
+func UnaryServerRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, header := serverRequestIDs(ctx)
+		grpc.SetHeader(ctx, header)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerRequestIDInterceptor is UnaryServerRequestIDInterceptor for streams
+func StreamServerRequestIDInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, header := serverRequestIDs(stream.Context())
+		stream.SetHeader(header)
+		wrapped := middle.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+// outgoingRequestIDs adds the request and trace ids of ctx to the outgoing metadata
+func outgoingRequestIDs(ctx context.Context) context.Context {
+	requestID := microservice.GetRequestIDByContext(ctx)
+	traceID := microservice.GetTraceIDByContext(ctx)
+	if requestID == "" && traceID == "" {
+		return ctx
+	}
+	requestID, traceID = requestIDs(requestID, traceID)
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	if len(md.Get(RequestIDHeader)) == 0 {
+		md.Set(RequestIDHeader, requestID)
+	}
+	if len(md.Get(TraceIDHeader)) == 0 {
+		md.Set(TraceIDHeader, traceID)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// UnaryClientRequestIDInterceptor forwards the request and trace ids stored in
+// the context by the server interceptors or RequestIDMiddleware
+func UnaryClientRequestIDInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingRequestIDs(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientRequestIDInterceptor is UnaryClientRequestIDInterceptor for streams
+func StreamClientRequestIDInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingRequestIDs(ctx), desc, cc, method, opts...)
+	}
+}
+
+// RequestIDMiddleware reads the request and trace ids from the request headers,
+// or creates them, stores them in the request context and sets them as response headers
+func RequestIDMiddleware() HTTPMiddleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID, traceID := requestIDs(r.Header.Get(RequestIDHeader), r.Header.Get(TraceIDHeader))
+			r.Header.Set(RequestIDHeader, requestID)
+			r.Header.Set(TraceIDHeader, traceID)
+			w.Header().Set(RequestIDHeader, requestID)
+			w.Header().Set(TraceIDHeader, traceID)
+
+			ctx := microservice.SetRequestIDToContext(r.Context(), requestID)
+			ctx = microservice.SetTraceIDToContext(ctx, traceID)
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
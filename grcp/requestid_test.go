@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/microservice"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var requestID, traceID string
+	handler := RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = microservice.GetRequestIDByContext(r.Context())
+		traceID = microservice.GetTraceIDByContext(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(TraceIDHeader, "trace-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.NotEmpty(t, requestID)
+	require.Equal(t, "trace-1", traceID)
+	require.Equal(t, requestID, w.Header().Get(RequestIDHeader))
+	require.Equal(t, "trace-1", w.Header().Get(TraceIDHeader))
+}
+
+func TestRequestIDInterceptors(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "req-1", TraceIDHeader, "trace-1"))
+
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		require.Equal(t, "req-1", microservice.GetRequestIDByContext(ctx))
+		require.Equal(t, "trace-1", microservice.GetTraceIDByContext(ctx))
+		return nil, UnaryClientRequestIDInterceptor()(ctx, "/test.Service/Call", nil, nil, nil, invoker)
+	}
+
+	_, err := UnaryServerRequestIDInterceptor()(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	require.Equal(t, []string{"req-1"}, outgoing.Get(RequestIDHeader))
+	require.Equal(t, []string{"trace-1"}, outgoing.Get(TraceIDHeader))
+}
@@ -0,0 +1,287 @@
+package grpc
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/go-kit/kit/sd/lb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Jitter randomizes retry delays so clients failing together do not retry together
+type Jitter int
+
+const (
+	// NoJitter waits the exponential delay as is
+	NoJitter Jitter = iota
+	// FullJitter waits a random delay between zero and the exponential delay
+	FullJitter
+	// EqualJitter waits half the exponential delay plus a random delay up to the other half
+	EqualJitter
+)
+
+// DefaultRetryCodes are the grpc codes of calls worth retrying
+var DefaultRetryCodes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted}
+
+// RetryPolicy decides which failed calls are retried and when
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts of a call, including the first one
+	MaxAttempts int
+	// Codes are the grpc codes retried, other errors are returned at once
+	Codes []codes.Code
+	// BaseDelay is the delay before the first retry, doubled on every retry up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Jitter    Jitter
+	// Budget is the max time spent on a call including its retries, no limit when zero.
+	// Retries are also not attempted when they would end after the context deadline.
+	Budget time.Duration
+	// HedgingDelay enables hedging when set: when no response is received
+	// within the delay another attempt is sent, the first success is used.
+	// Hedging is only done by the client interceptors, requests must be idempotent.
+	HedgingDelay time.Duration
+}
+
+// DefaultRetryPolicy returns policy retrying DefaultRetryCodes 3 times
+// from 200ms up to 1s with full jitter
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Codes:       DefaultRetryCodes,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Jitter:      FullJitter,
+	}
+}
+
+// Retryable reports whether err has one of the retried codes,
+// calls rejected by an open circuit breaker are not retried
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil || isBreakerOpen(err) {
+		return false
+	}
+	code := status.Code(err)
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before retrying after attempt failed, attempt starts at 1
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	switch p.Jitter {
+	case FullJitter:
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	case EqualJitter:
+		half := delay / 2
+		return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+	}
+	return delay
+}
+
+// Callback returns lb.Callback applying the policy, to be used with lb.RetryWithCallback.
+// The deadline of lb retries is the timeout given to lb.RetryWithCallback.
+func (p RetryPolicy) Callback() lb.Callback {
+	return p.CallbackContext(context.Background())
+}
+
+// CallbackContext returns lb.Callback applying the policy which stops
+// waiting and retrying when ctx is done, e.g. on shutdown of the client
+func (p RetryPolicy) CallbackContext(ctx context.Context) lb.Callback {
+	return func(n int, err error) (bool, error) {
+		if n >= p.MaxAttempts || !p.Retryable(err) {
+			return false, nil
+		}
+		timer := time.NewTimer(p.Backoff(n))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-timer.C:
+			return true, nil
+		}
+	}
+}
+
+// wait sleeps before retrying attempt, it returns false when the
+// retry would not end before the context deadline or the budget
+func (p RetryPolicy) wait(ctx context.Context, attempt int, start time.Time) bool {
+	delay := p.Backoff(attempt)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+	if p.Budget > 0 && time.Since(start)+delay >= p.Budget {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (p RetryPolicy) budgetContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Budget > 0 {
+		return context.WithTimeout(ctx, p.Budget)
+	}
+	return context.WithCancel(ctx)
+}
+
+// UnaryClientRetryInterceptor returns grpc client interceptor retrying calls with policy
+func UnaryClientRetryInterceptor(policy RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := reply.(proto.Message); ok && policy.HedgingDelay > 0 && policy.MaxAttempts > 1 {
+			return policy.hedge(ctx, method, req, reply.(proto.Message), cc, invoker, opts...)
+		}
+
+		start := time.Now()
+		ctx, cancel := policy.budgetContext(ctx)
+		defer cancel()
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) || ctx.Err() != nil {
+				return err
+			}
+			if !policy.wait(ctx, attempt, start) {
+				return err
+			}
+		}
+	}
+}
+
+// StreamClientRetryInterceptor returns grpc client interceptor retrying to open streams with policy,
+// messages of an opened stream are not retried. Budget bounds the attempts to open the stream,
+// not the lifetime of the opened stream.
+func StreamClientRetryInterceptor(policy RetryPolicy) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		for attempt := 1; ; attempt++ {
+			stream, err := policy.openStream(ctx, start, func(ctx context.Context) (grpc.ClientStream, error) {
+				return streamer(ctx, desc, cc, method, opts...)
+			})
+			if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) || ctx.Err() != nil {
+				return stream, err
+			}
+			if !policy.wait(ctx, attempt, start) {
+				return stream, err
+			}
+		}
+	}
+}
+
+// openStream opens a stream with a context cancelled when the budget elapses before
+// the stream is opened, the context of an opened stream is released when it ends
+func (p RetryPolicy) openStream(ctx context.Context, start time.Time, open func(context.Context) (grpc.ClientStream, error)) (grpc.ClientStream, error) {
+	if p.Budget <= 0 {
+		return open(ctx)
+	}
+	remaining := p.Budget - time.Since(start)
+	if remaining <= 0 {
+		return nil, status.Error(codes.DeadlineExceeded, "retry budget exceeded")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(remaining, cancel)
+	stream, err := open(ctx)
+	if !timer.Stop() && err == nil {
+		// the budget elapsed while the stream was opened
+		err = status.Error(codes.DeadlineExceeded, "retry budget exceeded")
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &budgetClientStream{ClientStream: stream, cancel: cancel}, nil
+}
+
+// budgetClientStream releases the context of the stream when it ends
+type budgetClientStream struct {
+	grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+func (s *budgetClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.cancel()
+	}
+	return err
+}
+
+type hedgeResult struct {
+	reply proto.Message
+	err   error
+}
+
+// hedge sends a new attempt every HedgingDelay or as soon as an attempt
+// fails with a retryable code, until one succeeds or MaxAttempts failed
+func (p RetryPolicy) hedge(ctx context.Context, method string, req interface{}, reply proto.Message, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := p.budgetContext(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, p.MaxAttempts)
+	attempts, pending := 0, 0
+	var next <-chan time.Time
+	send := func() {
+		attempts++
+		pending++
+		r := proto.Clone(reply)
+		go func() {
+			results <- hedgeResult{reply: r, err: invoker(ctx, method, req, r, cc, opts...)}
+		}()
+		next = nil
+		if attempts < p.MaxAttempts {
+			next = time.After(p.HedgingDelay)
+		}
+	}
+
+	send()
+	var err error
+	for {
+		select {
+		case <-next:
+			send()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				reply.Reset()
+				proto.Merge(reply, res.reply)
+				return nil
+			}
+			err = res.err
+			if !p.Retryable(err) {
+				return err
+			}
+			if attempts < p.MaxAttempts {
+				send()
+			} else if pending == 0 {
+				return err
+			}
+		case <-ctx.Done():
+			if err == nil {
+				err = status.FromContextError(ctx.Err()).Err()
+			}
+			return err
+		}
+	}
+}
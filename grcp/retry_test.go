@@ -0,0 +1,112 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	require.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	require.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	require.Equal(t, time.Second, policy.Backoff(10))
+
+	policy.Jitter = EqualJitter
+	for i := 0; i < 100; i++ {
+		d := policy.Backoff(2)
+		require.True(t, d >= 100*time.Millisecond && d <= 200*time.Millisecond, d)
+	}
+}
+
+func TestUnaryClientRetryInterceptor(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		if calls < 3 {
+			return status.Error(codes.Unavailable, "transport is closing")
+		}
+		return nil
+	}
+	require.NoError(t, UnaryClientRetryInterceptor(policy)(context.Background(), "/test.Service/Call", nil, nil, nil, invoker))
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	invoker = func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.InvalidArgument, "invalid")
+	}
+	err := UnaryClientRetryInterceptor(policy)(context.Background(), "/test.Service/Call", nil, nil, nil, invoker)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, 1, calls)
+}
+
+func TestUnaryClientRetryInterceptorHedging(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.HedgingDelay = 10 * time.Millisecond
+
+	calls := make(chan struct{}, 3)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls <- struct{}{}
+		if len(calls) == 1 {
+			// the first attempt hangs until the hedged one wins
+			<-ctx.Done()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		reply.(*wrapperspb.StringValue).Value = "hedged"
+		return nil
+	}
+
+	reply := &wrapperspb.StringValue{}
+	require.NoError(t, UnaryClientRetryInterceptor(policy)(context.Background(), "/test.Service/Call", nil, reply, nil, invoker))
+	require.Equal(t, "hedged", reply.GetValue())
+}
+
+func TestRetryPolicyCallbackContext(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = time.Hour
+	policy.MaxDelay = time.Hour
+	policy.Jitter = NoJitter
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	keepTrying, _ := policy.CallbackContext(ctx)(1, status.Error(codes.Unavailable, "unavailable"))
+	require.False(t, keepTrying)
+}
+
+func TestBackoffRetries(t *testing.T) {
+	cb := BackoffRetries(400 * time.Millisecond)
+	keepTrying, _ := cb(1, errors.New("no endpoints available"))
+	require.True(t, keepTrying)
+	keepTrying, _ = cb(2, errors.New("circuit breaker is open"))
+	require.False(t, keepTrying)
+}
+
+func TestStreamClientRetryInterceptorBudget(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 10
+	policy.BaseDelay = time.Millisecond
+	policy.Budget = 50 * time.Millisecond
+
+	calls := 0
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		calls++
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	start := time.Now()
+	_, err := StreamClientRetryInterceptor(policy)(context.Background(), &grpc.StreamDesc{}, nil, "/test.Service/Stream", streamer)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, 1, calls)
+}
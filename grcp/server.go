@@ -0,0 +1,603 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/soheilhy/cmux"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/healthcheck"
+	util "github.com/uninus-opensource/uninus-go-architect-common/log"
+)
+
+const (
+	// DefaultShutdownTimeout is the time given to in-flight requests to drain
+	DefaultShutdownTimeout = 30 * time.Second
+	// DefaultTLSPort is the port serving tls next to a plaintext port
+	DefaultTLSPort = "8443"
+)
+
+// ErrServerRunning is returned when Run is called on a server that is already running
+var ErrServerRunning = errors.New("server is already running")
+
+// Server serves a grpc server and its http gateway on a single port.
+// Unlike the Serve functions it can be stopped with Shutdown, which drains
+// in-flight grpc calls and http requests before returning.
+type Server struct {
+	address         string
+	listen          string
+	grpcServer      *grpc.Server
+	register        RegisterHTTPHandler
+	gatewayOpts     []runtime.ServeMuxOption
+	envelope        bool
+	handlers        []HTTPMiddleware
+	cors            HTTPMiddleware
+	option          HTTPOption
+	muxHandler      *MuxHandler
+	maxRecvMsgSize  int
+	dialOpts        []grpc.DialOption
+	creds           credentials.TransportCredentials
+	cert            tls.Certificate
+	certProvider    *CertProvider
+	mutualTLS       bool
+	tlsPort         string
+	debugAddress    string
+	debugToken      string
+	health          bool
+	healthRegistry  *healthcheck.Registry
+	shutdownTimeout time.Duration
+	logger          log.Logger
+
+	mu           sync.Mutex
+	running      bool
+	healthServer *health.Server
+	httpServers  []*http.Server
+	listeners    []net.Listener
+	cmuxes       []cmux.CMux
+	admin        *grpc.Server
+	done         chan struct{}
+	doneOnce     sync.Once
+}
+
+// ServerOption sets an optional parameter for Server
+type ServerOption func(*Server)
+
+// WithAddress sets the grpc address dialed by the gateway and the port to listen on
+func WithAddress(address, port string) ServerOption {
+	return func(s *Server) {
+		s.address = address
+		s.listen = fmt.Sprintf(":%s", port)
+	}
+}
+
+// WithListenAddress sets the address to listen on, e.g. "0.0.0.0:8080"
+func WithListenAddress(address string) ServerOption {
+	return func(s *Server) { s.listen = address }
+}
+
+// WithGRPCServer sets the grpc server to serve
+func WithGRPCServer(grpcServer *grpc.Server) ServerOption {
+	return func(s *Server) { s.grpcServer = grpcServer }
+}
+
+// WithGateway registers grpc-gateway handlers to the http mux
+func WithGateway(register RegisterHTTPHandler) ServerOption {
+	return func(s *Server) { s.register = register }
+}
+
+// WithGatewayOptions appends options of the gateway mux
+func WithGatewayOptions(opts ...runtime.ServeMuxOption) ServerOption {
+	return func(s *Server) { s.gatewayOpts = append(s.gatewayOpts, opts...) }
+}
+
+// WithResponseEnvelope wraps gateway responses in Response
+// and answers errors with the http status matching their grpc code
+func WithResponseEnvelope() ServerOption {
+	return func(s *Server) { s.envelope = true }
+}
+
+// WithMuxHandler serves the gateway and a supplementary handler under their own top paths
+func WithMuxHandler(muxHandler MuxHandler) ServerOption {
+	return func(s *Server) { s.muxHandler = &muxHandler }
+}
+
+// WithMaxRecvMsgSize sets max message size of the calls made by the gateway
+func WithMaxRecvMsgSize(size int) ServerOption {
+	return func(s *Server) { s.maxRecvMsgSize = size }
+}
+
+// WithAllowedOrigins sets the origins accepted by CORSHandlerWithAllowedOrigin.
+//
+// Deprecated: use WithCORSPolicy with AllowedOriginsCORSPolicy instead.
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		if len(origins) > 0 {
+			allowedOriginsCORS.Store(legacyAllowedOriginsCORS(origins...))
+		}
+	}
+}
+
+// WithCORSPolicy enables cross-origin resource sharing for policy on the http handler
+func WithCORSPolicy(policy CORSPolicy) ServerOption {
+	return func(s *Server) { s.cors = CORSMiddleware(policy) }
+}
+
+// WithDialOptions sets options used by the gateway to dial the grpc server,
+// replacing the transport credentials derived from WithTLS
+func WithDialOptions(opts ...grpc.DialOption) ServerOption {
+	return func(s *Server) { s.dialOpts = append(s.dialOpts, opts...) }
+}
+
+// WithHTTPMiddleware appends middlewares wrapping the http handler
+func WithHTTPMiddleware(handlers ...HTTPMiddleware) ServerOption {
+	return func(s *Server) { s.handlers = append(s.handlers, handlers...) }
+}
+
+// WithHTTPOption sets read and write timeout of the http server
+func WithHTTPOption(option HTTPOption) ServerOption {
+	return func(s *Server) { s.option = option }
+}
+
+// WithTLS serves grpc and http over tls on the listening port
+func WithTLS(creds credentials.TransportCredentials, cert tls.Certificate) ServerOption {
+	return func(s *Server) {
+		s.creds = creds
+		s.cert = cert
+	}
+}
+
+// WithCertProvider serves grpc and http over tls with the certificates of provider,
+// they are rotated without restarting the server. Mutual requires client certificates.
+func WithCertProvider(provider *CertProvider, mutual bool) ServerOption {
+	return func(s *Server) {
+		s.creds = provider.ServerCredentials(mutual)
+		s.certProvider = provider
+		s.mutualTLS = mutual
+	}
+}
+
+// WithTLSPort keeps the listening port in plaintext and serves tls on port instead
+func WithTLSPort(port string) ServerOption {
+	return func(s *Server) { s.tlsPort = port }
+}
+
+// WithDebugAddress serves the debug handlers, e.g. MetricsPath, on address,
+// e.g. config.Addr_debug. They are not served without it, the address must not be public.
+func WithDebugAddress(address string) ServerOption {
+	return func(s *Server) { s.debugAddress = address }
+}
+
+// WithDebugToken allows the requests of the debug server with the bearer token
+// to change the log level, it can not be changed without token
+func WithDebugToken(token string) ServerOption {
+	return func(s *Server) { s.debugToken = token }
+}
+
+// WithHealth registers grpc health service and the http probes of the health registry
+// of the server, see HealthRegistry. Every service is serving while the checkers
+// registered to it pass.
+func WithHealth() ServerOption {
+	return func(s *Server) { s.health = true }
+}
+
+// WithHealthRegistry is WithHealth using the checkers of registry
+func WithHealthRegistry(registry *healthcheck.Registry) ServerOption {
+	return func(s *Server) {
+		s.health = true
+		s.healthRegistry = registry
+	}
+}
+
+// WithShutdownTimeout sets the drain time used when the run context is done
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) { s.shutdownTimeout = timeout }
+}
+
+// WithLogger sets the server logger
+func WithLogger(logger log.Logger) ServerOption {
+	return func(s *Server) { s.logger = logger }
+}
+
+// NewServer returns new server configured by opts
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		option:          DefaultHTTPOption(),
+		shutdownTimeout: DefaultShutdownTimeout,
+		logger:          log.NewNopLogger(),
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.health && s.healthRegistry == nil {
+		s.healthRegistry = healthcheck.NewRegistry(healthcheck.DefaultTimeout)
+	}
+	return s
+}
+
+// HealthRegistry returns the registry of the checkers of the server, nil when health is disabled
+func (s *Server) HealthRegistry() *healthcheck.Registry {
+	return s.registry()
+}
+
+// Run serves until ctx is done, Shutdown is called or a server fails.
+// It returns the first fatal error, nil when stopped gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrServerRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	gwCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := s.httpHandler(gwCtx)
+	if err != nil {
+		return err
+	}
+	s.registerHealth()
+	if registry := s.registry(); registry != nil {
+		go registry.Run(gwCtx, healthcheck.DefaultInterval)
+	}
+
+	lis, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return lis.Close()
+	default:
+	}
+	s.listeners = append(s.listeners, lis)
+	err = s.serve(g, lis, handler)
+	if err == nil {
+		s.serveDebug(g)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		s.Shutdown(context.Background())
+		g.Wait()
+		return err
+	}
+
+	g.Go(func() error {
+		select {
+		case <-gctx.Done():
+		case <-s.done:
+			return nil
+		}
+		sctx, scancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer scancel()
+		if err := s.Shutdown(sctx); err != nil {
+			s.logger.Log(util.LogError, err.Error())
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// Shutdown marks the health service as not serving, then stops accepting
+// connections and waits for in-flight grpc calls and http requests to finish.
+// When ctx is done before draining, remaining connections are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.doneOnce.Do(func() { close(s.done) })
+
+	s.mu.Lock()
+	healthServer := s.healthServer
+	httpServers := s.httpServers
+	muxes := s.cmuxes
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	if registry := s.registry(); registry != nil {
+		registry.Shutdown()
+	}
+	if healthServer != nil {
+		healthServer.Shutdown()
+	}
+
+	var wg sync.WaitGroup
+	errc := make(chan error, len(httpServers)+1)
+	for _, srv := range httpServers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			// the listeners of cmux share the port listener, it may be closed by the grpc server first
+			if err := ignoreClosed(srv.Shutdown(ctx)); err != nil {
+				errc <- err
+			}
+		}(srv)
+	}
+
+	if s.grpcServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				s.grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				s.grpcServer.Stop()
+				errc <- ctx.Err()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+
+	s.stopAdmin()
+	for _, m := range muxes {
+		m.Close()
+	}
+	for _, lis := range listeners {
+		lis.Close()
+	}
+
+	return <-errc
+}
+
+// ShutdownFunc returns function stopping the server within timeout,
+// to be passed to microservice.OnShutdown
+func (s *Server) ShutdownFunc(timeout time.Duration) func() {
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			s.logger.Log(util.LogError, err.Error())
+		}
+	}
+}
+
+// serve starts the servers accepting on lis, must be called with s.mu held
+func (s *Server) serve(g *errgroup.Group, lis net.Listener, handler http.Handler) error {
+	if s.grpcOnly() {
+		g.Go(func() error { return ignoreClosed(s.grpcServer.Serve(lis)) })
+		return nil
+	}
+
+	if s.creds != nil && s.tlsPort == "" {
+		s.serveTLS(g, lis, handler)
+		return nil
+	}
+
+	if s.grpcServer == nil {
+		srv := s.newHTTPServer(handler)
+		s.httpServers = append(s.httpServers, srv)
+		g.Go(func() error { return ignoreClosed(srv.Serve(lis)) })
+	} else {
+		// Match connections in order:
+		// First grpc, then HTTP.
+		m := cmux.New(lis)
+		grpcL := m.Match(cmux.HTTP2(), cmux.HTTP2HeaderField("content-type", "application/grpc"))
+		httpL := m.Match(cmux.HTTP1Fast())
+		srv := s.newHTTPServer(handler)
+		s.cmuxes = append(s.cmuxes, m)
+		s.httpServers = append(s.httpServers, srv)
+		g.Go(func() error { return ignoreClosed(s.grpcServer.Serve(grpcL)) })
+		g.Go(func() error { return ignoreClosed(srv.Serve(httpL)) })
+		g.Go(func() error { return ignoreClosed(m.Serve()) })
+	}
+
+	if s.creds != nil {
+		tlsLis, err := net.Listen("tcp", fmt.Sprintf(":%s", s.tlsPort))
+		if err != nil {
+			return err
+		}
+		s.listeners = append(s.listeners, tlsLis)
+		s.serveTLS(g, tlsLis, handler)
+	}
+	return nil
+}
+
+// serveDebug starts the debug server serving the admin grpc services
+// and http handlers, must be called with s.mu held.
+// The debug server is not required to serve, a listen error is only logged.
+func (s *Server) serveDebug(g *errgroup.Group) {
+	if s.debugAddress == "" {
+		return
+	}
+	lis, err := net.Listen("tcp", s.debugAddress)
+	if err != nil {
+		s.logger.Log(util.LogError, "debug server not started: "+err.Error())
+		return
+	}
+	s.listeners = append(s.listeners, lis)
+
+	m := cmux.New(lis)
+	grpcL := m.Match(cmux.HTTP2(), cmux.HTTP2HeaderField("content-type", "application/grpc"))
+	httpL := m.Match(cmux.Any())
+	s.admin = s.adminServer()
+	srv := &http.Server{Handler: s.debugHandler()}
+	s.cmuxes = append(s.cmuxes, m)
+	s.httpServers = append(s.httpServers, srv)
+	admin := s.admin
+	g.Go(func() error { return ignoreClosed(admin.Serve(grpcL)) })
+	g.Go(func() error { return ignoreClosed(srv.Serve(httpL)) })
+	g.Go(func() error { return ignoreClosed(m.Serve()) })
+}
+
+func (s *Server) serveTLS(g *errgroup.Group, lis net.Listener, handler http.Handler) {
+	if s.grpcServer != nil {
+		handler = grpcHandlerFunc(s.grpcServer, handler)
+	}
+	srv := s.newHTTPServer(handler)
+	srv.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{s.cert},
+		NextProtos:   []string{"h2"},
+	}
+	if s.certProvider != nil {
+		srv.TLSConfig = s.certProvider.ServerTLSConfig(s.mutualTLS)
+		srv.TLSConfig.NextProtos = []string{"h2"}
+	}
+	s.httpServers = append(s.httpServers, srv)
+	g.Go(func() error { return ignoreClosed(srv.Serve(tls.NewListener(lis, srv.TLSConfig))) })
+}
+
+// grpcOnly reports whether nothing is configured to be served over http,
+// neither the health probes nor tls
+func (s *Server) grpcOnly() bool {
+	return s.grpcServer != nil && s.register == nil && s.muxHandler == nil && s.cors == nil && len(s.handlers) == 0 &&
+		s.registry() == nil && s.creds == nil
+}
+
+// HTTPHandler returns the http handler served by Run, the gateway dials the grpc
+// server until ctx is done. It lets tests serve the handler without Run.
+func (s *Server) HTTPHandler(ctx context.Context) (http.Handler, error) {
+	return s.httpHandler(ctx)
+}
+
+func (s *Server) httpHandler(ctx context.Context) (http.Handler, error) {
+	muxOpts := []runtime.ServeMuxOption{runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{OrigName: true, EmitDefaults: true})}
+	if s.envelope {
+		muxOpts = EnvelopeServeMuxOptions()
+	}
+	mux := runtime.NewServeMux(append(muxOpts, s.gatewayOpts...)...)
+
+	register := s.register
+	if s.muxHandler != nil {
+		register = s.muxHandler.Register
+	}
+	if register != nil {
+		if err := register(ctx, mux, s.address, s.dialOptions()); err != nil {
+			return nil, err
+		}
+	}
+
+	var handler http.Handler
+	handler = mux
+	for _, hm := range s.handlers {
+		handler = hm(handler)
+	}
+
+	if s.muxHandler != nil {
+		supHandler := s.muxHandler.SupHandler
+		for _, hm := range s.handlers {
+			supHandler = hm(supHandler)
+		}
+		topMux := http.NewServeMux()
+		topMux.Handle(s.muxHandler.RegisterTopPath+"/", http.StripPrefix(s.muxHandler.RegisterTopPath, handler))
+		topMux.Handle(s.muxHandler.SupHandlerTopPath+"/", http.StripPrefix(s.muxHandler.SupHandlerTopPath, supHandler))
+		handler = topMux
+	}
+	if registry := s.registry(); registry != nil {
+		probes := http.NewServeMux()
+		probes.Handle(healthcheck.LivePath, registry.LiveHandler())
+		probes.Handle(healthcheck.ReadyPath, registry.ReadyHandler())
+		probes.Handle("/", handler)
+		handler = probes
+	}
+	handler = DeadlineMiddleware(ConfigDeadlineLimiter(s.logger))(handler)
+	handler = RequestIDMiddleware()(handler)
+	handler = MetricsMiddleware()(handler)
+
+	if s.cors != nil {
+		handler = s.cors(handler)
+	}
+	return handler, nil
+}
+
+// dialOptions returns options used by the gateway to dial the grpc server
+func (s *Server) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{transportDialOption(s.creds)}
+	if s.certProvider != nil {
+		opts = []grpc.DialOption{transportDialOption(s.certProvider.ClientCredentials())}
+	}
+	if len(s.dialOpts) > 0 {
+		opts = append([]grpc.DialOption{}, s.dialOpts...)
+	}
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(UnaryClientRequestIDInterceptor()),
+		grpc.WithChainStreamInterceptor(StreamClientRequestIDInterceptor()),
+	)
+	if s.maxRecvMsgSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(s.maxRecvMsgSize), grpc.MaxCallSendMsgSize(s.maxRecvMsgSize)))
+	}
+	return opts
+}
+
+// registry returns the health registry of the server, nil when health is disabled
+func (s *Server) registry() *healthcheck.Registry {
+	if !s.health {
+		return nil
+	}
+	return s.healthRegistry
+}
+
+func (s *Server) registerHealth() {
+	if !s.health || s.grpcServer == nil {
+		return
+	}
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s.grpcServer, healthServer)
+	var services []string
+	for name := range s.grpcServer.GetServiceInfo() {
+		services = append(services, name)
+	}
+	s.registry().Attach(healthServer, services)
+
+	s.mu.Lock()
+	s.healthServer = healthServer
+	s.mu.Unlock()
+}
+
+func (s *Server) newHTTPServer(handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:    s.address,
+		Handler: handler,
+	}
+	if s.option.ReadTimeout > 0 {
+		srv.ReadTimeout = s.option.ReadTimeout
+	}
+	if s.option.WriteTimeout > 0 {
+		srv.WriteTimeout = s.option.WriteTimeout
+	}
+	return srv
+}
+
+// ignoreClosed drops errors returned by servers and listeners closed on shutdown
+func ignoreClosed(err error) error {
+	if err == nil ||
+		errors.Is(err, http.ErrServerClosed) ||
+		errors.Is(err, grpc.ErrServerStopped) ||
+		errors.Is(err, cmux.ErrListenerClosed) ||
+		errors.Is(err, cmux.ErrServerClosed) ||
+		errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func transportDialOption(creds credentials.TransportCredentials) grpc.DialOption {
+	if creds == nil {
+		return grpc.WithInsecure()
+	}
+	return grpc.WithTransportCredentials(creds)
+}
@@ -0,0 +1,105 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/healthcheck"
+)
+
+func waitListening(t *testing.T, s *Server) net.Addr {
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		listeners := s.listeners
+		s.mu.Unlock()
+		if len(listeners) > 0 {
+			return listeners[0].Addr()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server is not listening")
+	return nil
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := NewServer(
+		WithGRPCServer(grpc.NewServer()),
+		WithAddress("", "0"),
+		WithHealth(),
+	)
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(context.Background()) }()
+	waitListening(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	require.NoError(t, <-errc)
+	require.Equal(t, ErrServerRunning, s.Run(context.Background()))
+}
+
+func TestServerRunContextDone(t *testing.T) {
+	s := NewServer(
+		WithGRPCServer(grpc.NewServer()),
+		WithAddress("", "0"),
+		WithShutdownTimeout(time.Second),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(ctx) }()
+	waitListening(t, s)
+
+	cancel()
+	require.NoError(t, <-errc)
+}
+
+func TestServerHealthRegistry(t *testing.T) {
+	s1 := NewServer(WithHealth())
+	s2 := NewServer(WithHealth())
+	require.NotNil(t, s1.HealthRegistry())
+	require.NotSame(t, s1.HealthRegistry(), s2.HealthRegistry())
+	require.Nil(t, NewServer().HealthRegistry())
+}
+
+func TestServerGRPCOnlyHealthProbes(t *testing.T) {
+	s := NewServer(
+		WithGRPCServer(grpc.NewServer()),
+		WithAddress("", "0"),
+		WithHealth(),
+	)
+	require.False(t, s.grpcOnly())
+	require.True(t, NewServer(WithGRPCServer(grpc.NewServer())).grpcOnly())
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(context.Background()) }()
+	addr := waitListening(t, s)
+	defer func() {
+		require.NoError(t, s.Shutdown(context.Background()))
+		require.NoError(t, <-errc)
+	}()
+
+	res, err := http.Get("http://" + addr.String() + healthcheck.LivePath)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestServerGRPCOnlyTLS(t *testing.T) {
+	s := NewServer(WithGRPCServer(grpc.NewServer()), WithTLSPort("0"), WithTLS(credentials.NewTLS(&tls.Config{}), tls.Certificate{}))
+	require.False(t, s.grpcOnly())
+}
+
+func TestConfigDeadlineLimiterShared(t *testing.T) {
+	require.Same(t, ConfigDeadlineLimiter(log.NewNopLogger()), ConfigDeadlineLimiter(log.NewNopLogger()))
+}
@@ -0,0 +1,116 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-kit/kit/sd"
+	"github.com/go-redis/redis"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/cache"
+	cfg "github.com/uninus-opensource/uninus-go-architect-common/config"
+)
+
+// healthKey is read by CacheChecker from caches not implementing cache.Pinger
+const healthKey = "healthcheck"
+
+// CacheChecker returns checker pinging the redis of c. The redis client has no context
+// support, the registry fails the check when its timeout expires first.
+func CacheChecker(c cache.HashCache) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if p, ok := c.(cache.Pinger); ok {
+			return p.Ping()
+		}
+		_, err := c.Get(healthKey, healthKey)
+		if err == redis.Nil {
+			return nil
+		}
+		return err
+	})
+}
+
+// PubSubChecker returns checker pinging the redis of ps, like CacheChecker
+// the registry fails the check when its timeout expires first
+func PubSubChecker(ps cache.PubSubRedis) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		p, ok := ps.(cache.Pinger)
+		if !ok {
+			return nil
+		}
+		return p.Ping()
+	})
+}
+
+// DB is implemented by *sql.DB
+type DB interface {
+	PingContext(ctx context.Context) error
+}
+
+// DBChecker returns checker pinging db
+func DBChecker(db DB) Checker {
+	return CheckerFunc(db.PingContext)
+}
+
+// ConfigChecker returns checker dialing the etcd or zookeeper hosts of config.AppConfig,
+// it passes when one of them is reachable or when the config is local
+func ConfigChecker() Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		hosts := cfg.AppConfig.ConfigHosts
+		if len(hosts) == 0 {
+			return nil
+		}
+		var d net.Dialer
+		var err error
+		for _, host := range hosts {
+			var conn net.Conn
+			if conn, err = d.DialContext(ctx, "tcp", host); err == nil {
+				return conn.Close()
+			}
+		}
+		return fmt.Errorf("config hosts are unreachable: %v", err)
+	})
+}
+
+// GRPCChecker returns checker calling the grpc health service of conn for service.
+// When the downstream does not serve the health service, the connection state is checked.
+func GRPCChecker(conn *grpc.ClientConn, service string) Checker {
+	client := healthpb.NewHealthClient(conn)
+	return CheckerFunc(func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if status.Code(err) == codes.Unimplemented {
+			if state := conn.GetState(); state == connectivity.TransientFailure || state == connectivity.Shutdown {
+				return fmt.Errorf("connection is %s", state)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("%s is %s", service, resp.GetStatus())
+		}
+		return nil
+	})
+}
+
+// EndpointerChecker returns checker passing when endpointer discovered at least one endpoint,
+// e.g. the instances of a downstream service used by grcp.EndpointFactory
+func EndpointerChecker(endpointer sd.Endpointer) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		endpoints, err := endpointer.Endpoints()
+		if err != nil {
+			return err
+		}
+		if len(endpoints) == 0 {
+			return errors.New("no endpoints discovered")
+		}
+		return nil
+	})
+}
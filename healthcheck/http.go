@@ -0,0 +1,65 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Paths of the probes served by Handler
+const (
+	LivePath  = "/healthz/live"
+	ReadyPath = "/healthz/ready"
+)
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// LiveHandler returns handler answering the liveness status, 503 when a check failed
+func (r *Registry) LiveHandler() http.Handler {
+	return r.handler(r.Liveness)
+}
+
+// ReadyHandler returns handler answering the readiness status, 503 when a check
+// failed or the server is shutting down
+func (r *Registry) ReadyHandler() http.Handler {
+	return r.handler(r.Readiness)
+}
+
+// handler answers the status of the report of check, the results of the checks
+// are not exposed since their errors may describe the internals of the service
+func (r *Registry) handler(check func(context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := check(req.Context())
+		code := http.StatusOK
+		if !report.Serving() {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, Report{Status: report.Status})
+	})
+}
+
+// ReportHandler returns handler answering the liveness and readiness reports with
+// the results of every check, to be served on a private address
+func (r *Registry) ReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		live, ready := r.Liveness(req.Context()), r.Readiness(req.Context())
+		code := http.StatusOK
+		if !live.Serving() || !ready.Serving() {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, map[string]Report{"live": live, "ready": ready})
+	})
+}
+
+// Handler returns handler serving LivePath and ReadyPath
+func (r *Registry) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(LivePath, r.LiveHandler())
+	mux.Handle(ReadyPath, r.ReadyHandler())
+	return mux
+}
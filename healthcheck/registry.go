@@ -0,0 +1,300 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// DefaultTimeout is the max duration of a check
+	DefaultTimeout = 2 * time.Second
+	// DefaultInterval is the interval between checks run by Registry.Run
+	DefaultInterval = 10 * time.Second
+)
+
+// Statuses of checks and reports, named like the grpc health statuses
+const (
+	StatusServing    = "SERVING"
+	StatusNotServing = "NOT_SERVING"
+)
+
+// ErrShuttingDown is the error of the readiness report during shutdown
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Checker checks a component the service depends on, e.g. redis or a database
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is a function used as Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the result of a check
+type Result struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Duration string   `json:"duration"`
+	Services []string `json:"services,omitempty"`
+}
+
+// Report is the aggregated result of the checks
+type Report struct {
+	Status string   `json:"status"`
+	Error  string   `json:"error,omitempty"`
+	Checks []Result `json:"checks,omitempty"`
+}
+
+// Serving reports whether every check passed
+func (r Report) Serving() bool {
+	return r.Status == StatusServing
+}
+
+type check struct {
+	name     string
+	checker  Checker
+	services []string
+}
+
+// affects reports whether a failure of the check makes service not serving
+func (c *check) affects(service string) bool {
+	if service == "" || len(c.services) == 0 {
+		return true
+	}
+	for _, s := range c.services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedReport is the last report of checks and its time
+type cachedReport struct {
+	report Report
+	at     time.Time
+}
+
+// Registry holds the checkers of the service components. The readiness of the
+// service is the aggregated result of its checkers, liveness only uses the
+// checkers registered with RegisterLiveness. A registry serves one server.
+type Registry struct {
+	timeout time.Duration
+
+	mu           sync.Mutex
+	readiness    []*check
+	liveness     []*check
+	healthServer *health.Server
+	services     []string
+	shutdown     bool
+	maxAge       time.Duration
+	ready        cachedReport
+	live         cachedReport
+
+	// checkMu serializes the checks run by Readiness and Liveness
+	checkMu sync.Mutex
+}
+
+// NewRegistry returns registry running each check within timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Registry{timeout: timeout, maxAge: DefaultInterval}
+}
+
+// Register adds readiness checker named name. When services are given, a failure
+// only makes these grpc services not serving, otherwise every service.
+func (r *Registry) Register(name string, checker Checker, services ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readiness = append(r.readiness, &check{name: name, checker: checker, services: services})
+}
+
+// RegisterLiveness adds liveness checker named name, a failure means the service must be restarted
+func (r *Registry) RegisterLiveness(name string, checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.liveness = append(r.liveness, &check{name: name, checker: checker})
+}
+
+// Attach makes the registry set the status of services and of the server ("")
+// on healthServer every time the readiness is checked, until Shutdown.
+// It replaces the previously attached health server.
+func (r *Registry) Attach(healthServer *health.Server, services []string) {
+	r.mu.Lock()
+	r.healthServer = healthServer
+	r.services = services
+	r.shutdown = false
+	r.mu.Unlock()
+	r.CheckReadiness(context.Background())
+}
+
+// Shutdown makes the readiness not serving, it is not reverted
+func (r *Registry) Shutdown() {
+	r.mu.Lock()
+	r.shutdown = true
+	healthServer := r.healthServer
+	r.mu.Unlock()
+	if healthServer != nil {
+		healthServer.Shutdown()
+	}
+}
+
+// CheckLiveness runs the liveness checkers
+func (r *Registry) CheckLiveness(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := r.liveness
+	r.mu.Unlock()
+	report := newReport(r.run(ctx, checks))
+
+	r.mu.Lock()
+	r.live = cachedReport{report: report, at: time.Now()}
+	r.mu.Unlock()
+	return report
+}
+
+// CheckReadiness runs the readiness checkers and updates the attached health server
+func (r *Registry) CheckReadiness(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := r.readiness
+	r.mu.Unlock()
+	results := r.run(ctx, checks)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := newReport(results)
+	r.ready = cachedReport{report: report, at: time.Now()}
+	if r.shutdown {
+		report.Status, report.Error = StatusNotServing, ErrShuttingDown.Error()
+		return report
+	}
+	if r.healthServer != nil {
+		for _, service := range append([]string{""}, r.services...) {
+			r.healthServer.SetServingStatus(service, servingStatus(checks, results, service))
+		}
+	}
+	return report
+}
+
+// Liveness returns the last liveness report, the checkers are only run
+// when it is older than the interval of Run
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.cached(ctx, &r.live, r.CheckLiveness)
+}
+
+// Readiness returns the last readiness report, the checkers are only run
+// when it is older than the interval of Run
+func (r *Registry) Readiness(ctx context.Context) Report {
+	r.mu.Lock()
+	shutdown := r.shutdown
+	r.mu.Unlock()
+	if shutdown {
+		return Report{Status: StatusNotServing, Error: ErrShuttingDown.Error()}
+	}
+	return r.cached(ctx, &r.ready, r.CheckReadiness)
+}
+
+// cached returns the report of last when it is recent, otherwise the report of check.
+// Concurrent callers wait for the running check instead of running the checkers again.
+func (r *Registry) cached(ctx context.Context, last *cachedReport, check func(context.Context) Report) Report {
+	r.checkMu.Lock()
+	defer r.checkMu.Unlock()
+	r.mu.Lock()
+	c := *last
+	maxAge := r.maxAge
+	r.mu.Unlock()
+	if !c.at.IsZero() && time.Since(c.at) < maxAge {
+		return c.report
+	}
+	return check(ctx)
+}
+
+// Run checks the readiness every interval until ctx is done, so the grpc health
+// service is updated without being polled and the probes serve the last results
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	r.mu.Lock()
+	// a report is kept until the next run, with some slack for slow checks
+	r.maxAge = interval + r.timeout
+	r.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckReadiness(ctx)
+		}
+	}
+}
+
+func (r *Registry) run(ctx context.Context, checks []*check) []Result {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := runCheck(cctx, c.checker)
+			result := Result{Name: c.name, Status: StatusServing, Duration: time.Since(start).String(), Services: c.services}
+			if err != nil {
+				result.Status, result.Error = StatusNotServing, err.Error()
+			}
+			results[i] = result
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// runCheck returns the error of checker, or the context error when it does not return in time
+func runCheck(ctx context.Context, checker Checker) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- checker.Check(ctx) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newReport(results []Result) Report {
+	results = append([]Result{}, results...)
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	report := Report{Status: StatusServing, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusServing {
+			report.Status = StatusNotServing
+		}
+	}
+	return report
+}
+
+func servingStatus(checks []*check, results []Result, service string) healthpb.HealthCheckResponse_ServingStatus {
+	for i, c := range checks {
+		if results[i].Status != StatusServing && c.affects(service) {
+			return healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
@@ -0,0 +1,109 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/cache"
+)
+
+func serviceStatus(t *testing.T, hs *health.Server, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := hs.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	require.NoError(t, err)
+	return resp.GetStatus()
+}
+
+func TestRegistry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := cache.NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	var downstreamErr error
+	r := NewRegistry(time.Second)
+	r.Register("redis", CacheChecker(hc))
+	r.Register("downstream", CheckerFunc(func(ctx context.Context) error { return downstreamErr }), "test.Orders")
+
+	hs := health.NewServer()
+	r.Attach(hs, []string{"test.Orders", "test.Users"})
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, serviceStatus(t, hs, ""))
+
+	downstreamErr = errors.New("connection refused")
+	report := r.CheckReadiness(context.Background())
+	require.False(t, report.Serving())
+	require.Equal(t, "downstream", report.Checks[0].Name)
+	require.Equal(t, "connection refused", report.Checks[0].Error)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, serviceStatus(t, hs, "test.Orders"))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, serviceStatus(t, hs, "test.Users"))
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NotContains(t, w.Body.String(), "connection refused")
+	w = httptest.NewRecorder()
+	r.ReportHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Contains(t, w.Body.String(), "connection refused")
+	w = httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, LivePath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	downstreamErr = nil
+	mr.Close()
+	require.Equal(t, StatusNotServing, r.CheckReadiness(context.Background()).Checks[1].Status)
+	mr.Restart()
+	require.True(t, r.CheckReadiness(context.Background()).Serving())
+
+	r.Shutdown()
+	w = httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	status := Report{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	require.Equal(t, Report{Status: StatusNotServing}, status)
+	require.Equal(t, ErrShuttingDown.Error(), r.Readiness(context.Background()).Error)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, serviceStatus(t, hs, "test.Users"))
+}
+
+func TestRegistryCachedReadiness(t *testing.T) {
+	calls := 0
+	r := NewRegistry(time.Second)
+	r.Register("counter", CheckerFunc(func(ctx context.Context) error {
+		calls++
+		return nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ReadyHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"status":"SERVING"}`, w.Body.String())
+	}
+	require.Equal(t, 1, calls)
+
+	r.mu.Lock()
+	r.maxAge = 0
+	r.mu.Unlock()
+	require.True(t, r.Readiness(context.Background()).Serving())
+	require.Equal(t, 2, calls)
+}
+
+func TestCacheCheckerContext(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hc := cache.NewRedisHashCache(mr.Addr(), "test")
+	defer hc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, runCheck(ctx, CacheChecker(hc)))
+	require.NoError(t, runCheck(context.Background(), CacheChecker(hc)))
+}
@@ -0,0 +1,200 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// StreamClient calls streaming rpcs with a go-kit style stream endpoint
+type StreamClient struct {
+	conn      *grpc.ClientConn
+	method    string
+	desc      *grpc.StreamDesc
+	enc       EncodeRequestStreamFunc
+	dec       DecodeResponseStreamFunc
+	grpcReply reflect.Type
+	before    []kitgrpc.ClientRequestFunc
+	after     []kitgrpc.ClientResponseFunc
+	finalizer []kitgrpc.ClientFinalizerFunc
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(*StreamClient)
+
+// ClientBefore functions are executed on the outgoing metadata before the
+// stream is opened.
+func ClientBefore(before ...kitgrpc.ClientRequestFunc) ClientOption {
+	return func(c *StreamClient) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter functions are executed on the response header before the first
+// response is decoded. The trailer is only complete once the stream ended.
+func ClientAfter(after ...kitgrpc.ClientResponseFunc) ClientOption {
+	return func(c *StreamClient) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer is executed at the end of every stream.
+// By default, no finalizer is registered.
+func ClientFinalizer(f ...kitgrpc.ClientFinalizerFunc) ClientOption {
+	return func(c *StreamClient) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// NewStreamClient returns client of the streaming rpc method of serviceName.
+// Pass a zero-value protobuf message of the rpc response type as grpcReply.
+func NewStreamClient(
+	conn *grpc.ClientConn,
+	serviceName string,
+	method string,
+	enc EncodeRequestStreamFunc,
+	dec DecodeResponseStreamFunc,
+	grpcReply interface{},
+	options ...ClientOption,
+) *StreamClient {
+	c := &StreamClient{
+		conn:   conn,
+		method: fmt.Sprintf("/%s/%s", serviceName, method),
+		desc:   &grpc.StreamDesc{ClientStreams: true, ServerStreams: true},
+		enc:    enc,
+		dec:    dec,
+		// We are using reflect.Indirect here to allow both reply structs and
+		// pointers to these reply structs. New consumers of the client should
+		// use structs directly, while existing consumers will not break if they
+		// remain to use pointers to structs.
+		grpcReply: reflect.TypeOf(reflect.Indirect(reflect.ValueOf(grpcReply)).Interface()),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Endpoint returns endpoint opening a stream of the rpc. The requests are encoded and
+// sent until requests is closed, the decoded responses are sent to responses.
+// Messages are only sent and received as fast as the server and the reader of
+// responses take them. The endpoint returns when the server ended the stream.
+// The JWT token of ctx at JWTTokenContextKey is sent as bearer authorization.
+func (c StreamClient) Endpoint() StreamEndpoint {
+	return func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) (err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// finalCtx is the context given to the finalizers, the context of the after functions once run
+		finalCtx := ctx
+		if len(c.finalizer) > 0 {
+			defer func() {
+				for _, f := range c.finalizer {
+					f(finalCtx, err)
+				}
+			}()
+		}
+
+		ctx = context.WithValue(ctx, kitgrpc.ContextKeyRequestMethod, c.method)
+
+		// keep the metadata already added to ctx
+		outgoing, _ := metadata.FromOutgoingContext(ctx)
+		md := outgoing.Copy()
+		ctx = ContextToGRPC()(ctx, &md)
+		for _, f := range c.before {
+			ctx = f(ctx, &md)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+
+		finalCtx = ctx
+		stream, err := c.conn.NewStream(ctx, c.desc, c.method)
+		if err != nil {
+			return err
+		}
+
+		// the send goroutine keeps its own context, ctx is changed by the after functions
+		sendCtx := ctx
+		sendErr := make(chan error, 1)
+		go func() {
+			err := c.send(sendCtx, stream, requests)
+			sendErr <- err
+			if err != nil {
+				cancel()
+			}
+		}()
+
+		// the error of a failed stream is returned by RecvMsg
+		header, _ := stream.Header()
+		afterCtx := ctx
+		for _, f := range c.after {
+			afterCtx = f(afterCtx, header, stream.Trailer())
+		}
+		finalCtx = afterCtx
+
+		for {
+			msg := reflect.New(c.grpcReply).Interface()
+			if err = stream.RecvMsg(msg); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				select {
+				case serr := <-sendErr:
+					if serr != nil {
+						return serr
+					}
+				default:
+				}
+				return err
+			}
+			resp, err := c.dec(afterCtx, msg)
+			if err != nil {
+				return err
+			}
+			select {
+			case responses <- resp:
+			case <-afterCtx.Done():
+				return afterCtx.Err()
+			}
+		}
+	}
+}
+
+// send encodes and sends requests until it is closed or the stream ended
+func (c StreamClient) send(ctx context.Context, stream grpc.ClientStream, requests <-chan interface{}) error {
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				return stream.CloseSend()
+			}
+			msg, err := c.enc(ctx, req)
+			if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(msg); err != nil {
+				if err == io.EOF {
+					// the stream ended, its status is returned by RecvMsg
+					return nil
+				}
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Channels runs the endpoint of c, returning the channel of its requests and of its
+// responses, both buffered by buffer messages. Close requests when all requests are sent.
+// responses is closed when the stream ended, its error is then sent on errc.
+func (c StreamClient) Channels(ctx context.Context, buffer int) (chan<- interface{}, <-chan interface{}, <-chan error) {
+	requests := make(chan interface{}, buffer)
+	responses := make(chan interface{}, buffer)
+	errc := make(chan error, 1)
+	e := c.Endpoint()
+	go func() {
+		err := e(ctx, requests, responses)
+		close(responses)
+		errc <- err
+	}()
+	return requests, responses, errc
+}
@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newTestStreamClient(t *testing.T, ss *StreamServer, options ...ClientOption) *StreamClient {
+	conn := newTestStreamConn(t, ss)
+	return NewStreamClient(conn, "test.Stream", "Call", encodeString, decodeString, wrapperspb.StringValue{}, options...)
+}
+
+func TestStreamClientChannels(t *testing.T) {
+	var authorization []string
+	upper := func(_ context.Context, req interface{}) (interface{}, error) {
+		return wrapperspb.String(strings.ToUpper(req.(*wrapperspb.StringValue).GetValue())), nil
+	}
+	ss := NewStreamServer(upper,
+		ServerBefore(func(ctx context.Context, md metadata.MD) context.Context {
+			authorization = md.Get("authorization")
+			return ctx
+		}),
+		ServerAfter(func(ctx context.Context, header *metadata.MD, trailer *metadata.MD) context.Context {
+			*header = metadata.Pairs("server", "test")
+			return ctx
+		}),
+	)
+
+	var header metadata.MD
+	c := newTestStreamClient(t, ss,
+		ClientBefore(func(ctx context.Context, md *metadata.MD) context.Context {
+			md.Set("user", "alice")
+			return ctx
+		}),
+		ClientAfter(func(ctx context.Context, h metadata.MD, _ metadata.MD) context.Context {
+			header = h
+			return ctx
+		}),
+	)
+
+	ctx := context.WithValue(context.Background(), JWTTokenContextKey, "token")
+	requests, responses, errc := c.Channels(ctx, 1)
+	for _, v := range []string{"a", "b", "c"} {
+		requests <- v
+		require.Equal(t, strings.ToUpper(v), <-responses)
+	}
+	close(requests)
+	_, ok := <-responses
+	require.False(t, ok)
+	require.NoError(t, <-errc)
+	require.Equal(t, []string{"bearer token"}, authorization)
+	require.Equal(t, []string{"test"}, header.Get("server"))
+}
+
+func TestStreamClientEndpoint(t *testing.T) {
+	join := func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error {
+		var values []string
+		for req := range requests {
+			if req.(string) == "fail" {
+				return status.Error(codes.InvalidArgument, "fail")
+			}
+			values = append(values, req.(string))
+		}
+		responses <- strings.Join(values, ",")
+		return nil
+	}
+	var finalErr error
+	c := newTestStreamClient(t, NewStreamingServer(join, decodeString, encodeString),
+		ClientFinalizer(func(ctx context.Context, err error) { finalErr = err }))
+
+	requests := make(chan interface{}, 3)
+	responses := make(chan interface{}, 1)
+	requests <- "a"
+	requests <- "b"
+	close(requests)
+	require.NoError(t, c.Endpoint()(context.Background(), requests, responses))
+	require.Equal(t, "a,b", <-responses)
+
+	requests = make(chan interface{}, 1)
+	requests <- "fail"
+	err := c.Endpoint()(context.Background(), requests, responses)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, err, finalErr)
+}
+
+func TestStreamClientAfterRace(t *testing.T) {
+	echo := func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error {
+		// the header is sent before any request is received
+		responses <- "x"
+		for req := range requests {
+			responses <- req
+		}
+		return nil
+	}
+	c := newTestStreamClient(t, NewStreamingServer(echo, decodeString, encodeString),
+		ClientAfter(func(ctx context.Context, _ metadata.MD, _ metadata.MD) context.Context {
+			return context.WithValue(ctx, contextKey("after"), true)
+		}),
+	)
+
+	const n = 50
+	requests, responses, errc := c.Channels(context.Background(), n)
+	for i := 0; i < n; i++ {
+		requests <- "x"
+	}
+	close(requests)
+	count := 0
+	for range responses {
+		count++
+	}
+	require.NoError(t, <-errc)
+	require.Equal(t, n+1, count)
+}
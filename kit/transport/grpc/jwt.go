@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	authorizationKey = "authorization"
+	// gatewayAuthorizationKey is the Authorization header forwarded by the grpc gateway
+	gatewayAuthorizationKey = runtime.MetadataPrefix + authorizationKey
+)
+
+// GRPCToContext moves the bearer token of the authorization metadata to the context
+// at JWTTokenContextKey, for unary and stream servers. The Authorization header
+// forwarded by the grpc gateway is used when the call has no authorization metadata.
+// Stream servers use it with ServerBefore(GRPCToContext()), go-kit unary servers
+// with kitgrpc.ServerBefore(GRPCToContext()).
+func GRPCToContext() kitgrpc.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		for _, key := range []string{authorizationKey, gatewayAuthorizationKey} {
+			if token, ok := extractTokenFromAuthHeader(mdValues(md, key)); ok {
+				return context.WithValue(ctx, JWTTokenContextKey, token)
+			}
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC moves the JWT token of the context at JWTTokenContextKey to the
+// authorization metadata of unary and stream clients
+func ContextToGRPC() kitgrpc.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if token, ok := ctx.Value(JWTTokenContextKey).(string); ok && token != "" {
+			(*md)[authorizationKey] = []string{generateAuthHeaderFromToken(token)}
+		}
+		return ctx
+	}
+}
+
+// mdValues returns the values of key in md, whatever the case of the keys of md
+func mdValues(md metadata.MD, key string) []string {
+	var values []string
+	for k, v := range md {
+		if strings.EqualFold(k, key) {
+			values = append(values, v...)
+		}
+	}
+	return values
+}
+
+// extractTokenFromAuthHeader returns the token of the first bearer authorization of values
+func extractTokenFromAuthHeader(values []string) (string, bool) {
+	for _, v := range values {
+		parts := strings.Fields(v)
+		if len(parts) == 2 && strings.EqualFold(parts[0], bearer) {
+			return parts[1], true
+		}
+	}
+	return "", false
+}
+
+func generateAuthHeaderFromToken(token string) string {
+	return bearer + " " + token
+}
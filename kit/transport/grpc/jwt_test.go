@@ -0,0 +1,57 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestGRPCToContext(t *testing.T) {
+	tests := []struct {
+		md    metadata.MD
+		token string
+	}{
+		{metadata.Pairs("authorization", "Bearer abc"), "abc"},
+		{metadata.MD{"Authorization": []string{"BEARER abc"}}, "abc"},
+		{metadata.Pairs("grpcgateway-authorization", "bearer abc"), "abc"},
+		{metadata.Pairs("authorization", "Basic abc"), ""},
+		{metadata.MD{}, ""},
+	}
+	for _, tt := range tests {
+		ctx := GRPCToContext()(context.Background(), tt.md)
+		token, _ := ctx.Value(JWTTokenContextKey).(string)
+		require.Equal(t, tt.token, token, tt.md)
+	}
+
+	md := metadata.MD{}
+	ctx := context.WithValue(context.Background(), JWTTokenContextKey, "abc")
+	ContextToGRPC()(ctx, &md)
+	require.Equal(t, []string{"bearer abc"}, md.Get("authorization"))
+	ctx = GRPCToContext()(context.Background(), md)
+	require.Equal(t, "abc", ctx.Value(JWTTokenContextKey))
+}
+
+func TestStreamServerAuthentication(t *testing.T) {
+	key := []byte("secret")
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString(key)
+	require.NoError(t, err)
+
+	subject := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		claims := ctx.Value(kitjwt.JWTClaimsContextKey).(jwt.MapClaims)
+		return wrapperspb.String(claims["sub"].(string)), nil
+	}
+	parser := kitjwt.NewParser(func(*jwt.Token) (interface{}, error) { return key, nil }, jwt.SigningMethodHS256, kitjwt.MapClaimsFactory)
+	c := newTestStreamClient(t, NewStreamServer(parser(subject), ServerBefore(GRPCToContext())))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	requests, responses, errc := c.Channels(ctx, 1)
+	requests <- "x"
+	close(requests)
+	require.Equal(t, "alice", <-responses)
+	require.NoError(t, <-errc)
+}
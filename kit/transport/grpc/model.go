@@ -1,20 +1,38 @@
 package grpc
 
+import (
+	"context"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+)
+
 const (
 	// JWTTokenContextKey holds the key used to store a JWT Token in the
-	// context.
-	JWTTokenContextKey contextKey = "JWTToken"
-	bearer             string     = "bearer"
+	// context. It is the key of go-kit jwt, read by microservice.AuthenticateMiddleware.
+	JWTTokenContextKey = kitjwt.JWTTokenContextKey
+	bearer             = "bearer"
 )
 
 type (
-	// ContextFunc ..
+	// ContextFunc returns the context of a stream
 	ContextFunc func() interface{}
-	// RecvFunc ..
+	// RecvFunc receives the next message of a stream, io.EOF when the peer closed it
 	RecvFunc func() (interface{}, error)
-	// SendFunc ..
+	// SendFunc sends a message on a stream
 	SendFunc func(interface{}) error
 
+	// StreamEndpoint is the endpoint of streaming rpcs. It receives the decoded
+	// requests from requests, closed when the client closed its side of the stream,
+	// and sends the responses to responses. The stream ends when it returns.
+	StreamEndpoint func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error
+
 	// contextKey ..
 	contextKey string
 )
+
+// Stream is a grpc stream with untyped messages
+type Stream interface {
+	Context() context.Context
+	Recv() (interface{}, error)
+	Send(interface{}) error
+}
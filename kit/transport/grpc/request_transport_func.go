@@ -9,3 +9,9 @@ type DecodeRequestStreamFunc func(context.Context, interface{}) (interface{}, er
 
 // EncodeResponseStreamFunc ..
 type EncodeResponseStreamFunc func(context.Context, interface{}) (interface{}, error)
+
+// EncodeRequestStreamFunc encodes a request of StreamClient to the grpc message sent on the stream
+type EncodeRequestStreamFunc func(context.Context, interface{}) (interface{}, error)
+
+// DecodeResponseStreamFunc decodes a grpc message received by StreamClient to its response
+type DecodeResponseStreamFunc func(context.Context, interface{}) (interface{}, error)
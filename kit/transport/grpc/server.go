@@ -1,7 +1,9 @@
 package grpc
 
 import (
-	logs "log"
+	"context"
+	"errors"
+	"io"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
@@ -9,26 +11,21 @@ import (
 	oldcontext "golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-// StreamServer ..
+// StreamServer serves grpc streams with a go-kit style endpoint
 type StreamServer struct {
 	e         endpoint.Endpoint
+	se        StreamEndpoint
+	dec       DecodeRequestStreamFunc
+	enc       EncodeResponseStreamFunc
 	before    []kitgrpc.ServerRequestFunc
 	after     []kitgrpc.ServerResponseFunc
 	finalizer []kitgrpc.ServerFinalizerFunc
 	logger    log.Logger
 }
 
-// // BidirectionalStream ..
-// type BidirectionalStream struct {
-// 	ctx  ContextFunc
-// 	dec  DecodeRequestStreamFunc
-// 	enc  EncodeResponseStreamFunc
-// 	recv RecvFunc
-// 	send SendFunc
-// }
-
 // StreamHandler ..
 type StreamHandler interface {
 	ServeGRPCStream(oldcontext.Context, interface{}) (oldcontext.Context, interface{}, error)
@@ -61,7 +58,8 @@ func ServerFinalizer(f ...kitgrpc.ServerFinalizerFunc) ServerOption {
 	return func(s *StreamServer) { s.finalizer = append(s.finalizer, f...) }
 }
 
-// NewStreamServer ..
+// NewStreamServer returns server calling e for every message of a stream.
+// Use ServerBefore(GRPCToContext()) to move the bearer token of the stream to the context.
 func NewStreamServer(
 	e endpoint.Endpoint,
 	options ...ServerOption,
@@ -76,42 +74,22 @@ func NewStreamServer(
 	return ss
 }
 
-// // NewBidirectional ..
-// func NewBidirectional(
-// 	ctx ContextFunc,
-// 	recv RecvFunc,
-// 	send SendFunc,
-// ) *BidirectionalStream {
-// 	return &BidirectionalStream{
-// 		ctx:  ctx,
-// 		recv: recv,
-// 		send: send,
-// 	}
-// }
-
-// // InterfaceBidi ..
-// type InterfaceBidi interface {
-// 	Context() interface{}
-// 	Send(interface{}) error
-// 	Recv() (interface{}, error)
-// }
-
-// // Context ..
-// func (bs *BidirectionalStream) Context() interface{} {
-// 	return bs.ctx()
-// }
-
-// // Send ..
-// func (bs *BidirectionalStream) Send(x interface{}) error {
-// 	return bs.send(x)
-// }
-
-// // Recv ..
-// func (bs *BidirectionalStream) Recv() (interface{}, error) {
-// 	return bs.recv()
-// }
+// NewStreamingServer returns server of client streaming, server streaming and bidi rpcs.
+// Each received message is decoded by dec and each response of e is encoded by enc.
+func NewStreamingServer(
+	e StreamEndpoint,
+	dec DecodeRequestStreamFunc,
+	enc EncodeResponseStreamFunc,
+	options ...ServerOption,
+) *StreamServer {
+	ss := NewStreamServer(nil, options...)
+	ss.se = e
+	ss.dec = dec
+	ss.enc = enc
+	return ss
+}
 
-// ServeGRPCStream ..
+// ServeGRPCStream calls the endpoint once with param, use ServeStream to serve the messages of a stream
 func (s StreamServer) ServeGRPCStream(ctx oldcontext.Context, param interface{}) (oldctx oldcontext.Context, resp interface{}, err error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -132,7 +110,7 @@ func (s StreamServer) ServeGRPCStream(ctx oldcontext.Context, param interface{})
 
 	_, err = s.e(ctx, param)
 	if err != nil {
-		logs.Println(err)
+		s.logger.Log("err", err)
 		return ctx, nil, err
 	}
 
@@ -157,109 +135,149 @@ func (s StreamServer) ServeGRPCStream(ctx oldcontext.Context, param interface{})
 	return ctx, nil, err
 }
 
-// func (s StreamServer) ServeGRPCStream(req interface{}) (resp interface{}, err error) {
-// 	r := req.(*BidirectionalStream)
-// 	var cek bool
-
-// 	md, ok := metadata.FromIncomingContext(r.ctx)
-// 	if !ok {
-// 		md = metadata.MD{}
-// 	}
-
-// 	if len(s.finalizer) > 0 {
-// 		defer func() {
-// 			for _, f := range s.finalizer {
-// 				f(r.ctx, err)
-// 			}
-// 		}()
-// 	}
-
-// 	for _, f := range s.before {
-// 		r.ctx = f(r.ctx, md)
-// 	}
-
-// 	for {
-// 		select {
-// 		case <-r.ctx.Done():
-// 			return nil, nil
-// 		default:
-// 		}
-
-// 		receiver, err := r.recv()
-// 		fmt.Println("=> recv:", receiver)
-// 		if err == io.EOF {
-// 			return nil, err
-// 		}
-// 		if err != nil {
-// 			logs.Println(err)
-// 			return nil, err
-// 		}
-
-// 		if !cek {
-
-// 			request, err := r.dec(r.ctx, receiver)
-// 			if err != nil {
-// 				logs.Println(err)
-// 				return nil, err
-// 			}
-
-// 			response, err := s.e(r.ctx, request)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 				return nil, err
-// 			}
+// ServeStream serves stream until the endpoint returns. The before functions are run
+// on the incoming metadata, the after functions before the first response is sent,
+// so they can set the stream headers. The stream is canceled when the client
+// cancels it or a message can not be received, decoded, encoded or sent.
+// Servers made by NewStreamServer call the endpoint for every message.
+func (s StreamServer) ServeStream(stream Stream) (err error) {
+	ctx := stream.Context()
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
 
-// 			var mdHeader, mdTrailer metadata.MD
-// 			for _, f := range s.after {
-// 				r.ctx = f(r.ctx, &mdHeader, &mdTrailer)
-// 			}
+	// finalCtx is the context given to the finalizers, the context of the after functions once run
+	finalCtx := ctx
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(finalCtx, err)
+			}
+		}()
+	}
 
-// 			grpcStream, err := r.enc(r.ctx, response)
-// 			if err != nil {
-// 				logs.Println(err)
-// 				return nil, err
-// 			}
-// 			r.send(grpcStream)
+	for _, f := range s.before {
+		ctx = f(ctx, md)
+	}
 
-// 			var ep = func(ctx context.Context, val interface{}) (interface{}, error) {
-// 				var ab []byte
-// 				ab = val.([]byte)
+	// ctx is used by the goroutines below and must not be reassigned after they start
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	finalCtx = ctx
 
-// 				ay, err := r.pu(ab)
-// 				if err != nil {
-// 					logs.Println(err)
-// 					return nil, err
-// 				}
+	e, dec, enc := s.se, s.dec, s.enc
+	if e == nil {
+		e = UnaryStreamEndpoint(s.e)
+	}
+	if dec == nil {
+		dec = nopStreamCodec
+	}
+	if enc == nil {
+		enc = nopStreamCodec
+	}
 
-// 				request, err := r.dec(r.ctx, ay)
-// 				if err != nil {
-// 					logs.Println(err)
-// 					return nil, err
-// 				}
+	requests := make(chan interface{})
+	responses := make(chan interface{})
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(requests)
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err == nil {
+				msg, err = dec(ctx, msg)
+			}
+			if err != nil {
+				recvErr <- err
+				cancel()
+				return
+			}
+			select {
+			case requests <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	endpointErr := make(chan error, 1)
+	go func() {
+		defer close(responses)
+		endpointErr <- e(ctx, requests, responses)
+	}()
+
+	var afterCtx context.Context
+	var sendErr error
+	for resp := range responses {
+		if sendErr != nil {
+			continue
+		}
+		if afterCtx == nil {
+			afterCtx = s.runAfter(ctx)
+		}
+		if sendErr = s.send(afterCtx, stream, enc, resp); sendErr != nil {
+			cancel()
+		}
+	}
+	if afterCtx == nil {
+		afterCtx = s.runAfter(ctx)
+	}
+	finalCtx = afterCtx
 
-// 				response, err := s.e(r.ctx, request)
-// 				if err != nil {
-// 					logs.Println(err)
-// 					return nil, err
-// 				}
+	err = <-endpointErr
+	select {
+	case rerr := <-recvErr:
+		err = rerr
+	default:
+	}
+	if sendErr != nil {
+		err = sendErr
+	}
+	return streamError(stream.Context(), err)
+}
 
-// 				grpcStream, err := r.enc(r.ctx, response)
-// 				if err != nil {
-// 					logs.Println(err)
-// 					return nil, err
-// 				}
-// 				r.send(grpcStream)
+func (s StreamServer) send(ctx context.Context, stream Stream, enc EncodeResponseStreamFunc, resp interface{}) error {
+	msg, err := enc(ctx, resp)
+	if err != nil {
+		s.logger.Log("err", err)
+		return err
+	}
+	return stream.Send(msg)
+}
 
-// 				return nil, nil
-// 			}
-// 			timeoutConsum, err := r.mq(ep)
-// 			if err != nil {
-// 				logs.Println(err)
-// 				return nil, err
-// 			}
+// runAfter runs the after functions, sending the header and setting the trailer they return
+func (s StreamServer) runAfter(ctx context.Context) context.Context {
+	var mdHeader, mdTrailer metadata.MD
+	for _, f := range s.after {
+		ctx = f(ctx, &mdHeader, &mdTrailer)
+	}
+	if len(mdHeader) > 0 {
+		if err := grpc.SendHeader(ctx, mdHeader); err != nil {
+			s.logger.Log("err", err)
+		}
+	}
+	if len(mdTrailer) > 0 {
+		if err := grpc.SetTrailer(ctx, mdTrailer); err != nil {
+			s.logger.Log("err", err)
+		}
+	}
+	return ctx
+}
 
-// 			defer r.mquns(timeoutConsum)
-// 			cek = true
-// 		}
-// 	}
-// }
+// streamError returns the status of the stream context when err is caused by
+// the client canceling the stream or its deadline
+func streamError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return err
+}
@@ -0,0 +1,228 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testStreamMethod = "/test.Stream/Call"
+
+// newTestStreamConn serves ss on a bufconn listener and returns a client connection to it
+func newTestStreamConn(t *testing.T, ss *StreamServer) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Stream",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName: "Call",
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				return ss.ServeStream(FromServerStream(stream, func() interface{} { return new(wrapperspb.StringValue) }))
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		}},
+	}, struct{}{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func newTestClientStream(t *testing.T, ctx context.Context, conn *grpc.ClientConn) grpc.ClientStream {
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, testStreamMethod)
+	require.NoError(t, err)
+	return stream
+}
+
+func recvAll(stream grpc.ClientStream) ([]string, error) {
+	var values []string
+	for {
+		m := new(wrapperspb.StringValue)
+		if err := stream.RecvMsg(m); err != nil {
+			if err == io.EOF {
+				return values, nil
+			}
+			return values, err
+		}
+		values = append(values, m.GetValue())
+	}
+}
+
+func decodeString(_ context.Context, m interface{}) (interface{}, error) {
+	return m.(*wrapperspb.StringValue).GetValue(), nil
+}
+
+func encodeString(_ context.Context, m interface{}) (interface{}, error) {
+	return wrapperspb.String(m.(string)), nil
+}
+
+func TestStreamServerBidirectional(t *testing.T) {
+	upper := func(_ context.Context, req interface{}) (interface{}, error) {
+		return wrapperspb.String(strings.ToUpper(req.(*wrapperspb.StringValue).GetValue())), nil
+	}
+	conn := newTestStreamConn(t, NewStreamServer(upper))
+	stream := newTestClientStream(t, context.Background(), conn)
+
+	for _, v := range []string{"a", "b"} {
+		require.NoError(t, stream.SendMsg(wrapperspb.String(v)))
+		m := new(wrapperspb.StringValue)
+		require.NoError(t, stream.RecvMsg(m))
+		require.Equal(t, strings.ToUpper(v), m.GetValue())
+	}
+	require.NoError(t, stream.CloseSend())
+	values, err := recvAll(stream)
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func TestStreamServerClientStreaming(t *testing.T) {
+	join := func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error {
+		var values []string
+		for req := range requests {
+			values = append(values, req.(string))
+		}
+		responses <- strings.Join(values, ",")
+		return nil
+	}
+	conn := newTestStreamConn(t, NewStreamingServer(join, decodeString, encodeString))
+	stream := newTestClientStream(t, context.Background(), conn)
+
+	for _, v := range []string{"a", "b", "c"} {
+		require.NoError(t, stream.SendMsg(wrapperspb.String(v)))
+	}
+	require.NoError(t, stream.CloseSend())
+	values, err := recvAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a,b,c"}, values)
+}
+
+func TestStreamServerServerStreaming(t *testing.T) {
+	repeat := func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error {
+		req := <-requests
+		for i := 0; i < 3; i++ {
+			responses <- req
+		}
+		return nil
+	}
+	var header, trailer metadata.MD
+	var finalErr error
+	finalized := make(chan struct{})
+	ss := NewStreamingServer(repeat, decodeString, encodeString,
+		ServerBefore(func(ctx context.Context, md metadata.MD) context.Context {
+			return context.WithValue(ctx, contextKey("user"), md.Get("user")[0])
+		}),
+		ServerAfter(func(ctx context.Context, header *metadata.MD, trailer *metadata.MD) context.Context {
+			*header = metadata.Pairs("user", ctx.Value(contextKey("user")).(string))
+			*trailer = metadata.Pairs("count", "3")
+			return ctx
+		}),
+		ServerFinalizer(func(ctx context.Context, err error) {
+			finalErr = err
+			close(finalized)
+		}),
+	)
+	conn := newTestStreamConn(t, ss)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "user", "alice")
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, testStreamMethod, grpc.Header(&header), grpc.Trailer(&trailer))
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(wrapperspb.String("x")))
+	require.NoError(t, stream.CloseSend())
+
+	values, err := recvAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, []string{"x", "x", "x"}, values)
+	require.Equal(t, []string{"alice"}, header.Get("user"))
+	require.Equal(t, []string{"3"}, trailer.Get("count"))
+	<-finalized
+	require.NoError(t, finalErr)
+}
+
+func TestStreamServerErrors(t *testing.T) {
+	finalErrs := make(chan error, 1)
+	block := func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error {
+		for req := range requests {
+			if req.(string) == "fail" {
+				return status.Error(codes.InvalidArgument, "fail")
+			}
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ss := NewStreamingServer(block, decodeString, encodeString,
+		ServerFinalizer(func(ctx context.Context, err error) { finalErrs <- err }))
+	conn := newTestStreamConn(t, ss)
+
+	stream := newTestClientStream(t, context.Background(), conn)
+	require.NoError(t, stream.SendMsg(wrapperspb.String("fail")))
+	_, err := recvAll(stream)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, codes.InvalidArgument, status.Code(<-finalErrs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = newTestClientStream(t, ctx, conn)
+	require.NoError(t, stream.SendMsg(wrapperspb.String("ok")))
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-finalErrs:
+		require.Equal(t, codes.Canceled, status.Code(err))
+	case <-time.After(time.Second):
+		t.Fatal("stream was not canceled")
+	}
+
+	decodeErr := errors.New("invalid message")
+	ss = NewStreamingServer(block, func(context.Context, interface{}) (interface{}, error) { return nil, decodeErr }, encodeString,
+		ServerFinalizer(func(ctx context.Context, err error) { finalErrs <- err }))
+	stream = newTestClientStream(t, context.Background(), newTestStreamConn(t, ss))
+	require.NoError(t, stream.SendMsg(wrapperspb.String("x")))
+	_, err = recvAll(stream)
+	require.Error(t, err)
+	require.Equal(t, decodeErr, <-finalErrs)
+}
+
+func TestStreamServerAfterRace(t *testing.T) {
+	echo := func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error {
+		for req := range requests {
+			responses <- req
+		}
+		return nil
+	}
+	ss := NewStreamingServer(echo, decodeString, encodeString,
+		ServerAfter(func(ctx context.Context, header *metadata.MD, trailer *metadata.MD) context.Context {
+			return context.WithValue(ctx, contextKey("after"), true)
+		}),
+	)
+	stream := newTestClientStream(t, context.Background(), newTestStreamConn(t, ss))
+
+	const n = 50
+	go func() {
+		for i := 0; i < n; i++ {
+			stream.SendMsg(wrapperspb.String("x"))
+		}
+		stream.CloseSend()
+	}()
+	values, err := recvAll(stream)
+	require.NoError(t, err)
+	require.Len(t, values, n)
+}
@@ -0,0 +1,102 @@
+package grpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc"
+)
+
+// BidirectionalStream is a Stream built from functions, so the typed streams of
+// generated grpc code can be served by StreamServer
+type BidirectionalStream struct {
+	ctx  ContextFunc
+	recv RecvFunc
+	send SendFunc
+}
+
+// NewBidirectional returns stream using ctx, recv and send, e.g. for a generated bidi stream:
+//
+//	NewBidirectional(
+//		func() interface{} { return stream.Context() },
+//		func() (interface{}, error) { return stream.Recv() },
+//		func(m interface{}) error { return stream.Send(m.(*pb.Response)) },
+//	)
+//
+// Client streaming rpcs use SendAndClose as send.
+func NewBidirectional(ctx ContextFunc, recv RecvFunc, send SendFunc) *BidirectionalStream {
+	return &BidirectionalStream{
+		ctx:  ctx,
+		recv: recv,
+		send: send,
+	}
+}
+
+// NewServerStreaming returns stream of a server streaming rpc receiving req only
+func NewServerStreaming(ctx ContextFunc, req interface{}, send SendFunc) *BidirectionalStream {
+	received := false
+	return NewBidirectional(ctx, func() (interface{}, error) {
+		if received {
+			return nil, io.EOF
+		}
+		received = true
+		return req, nil
+	}, send)
+}
+
+// FromServerStream returns stream receiving the messages of stream in new messages of newRequest
+func FromServerStream(stream grpc.ServerStream, newRequest func() interface{}) *BidirectionalStream {
+	return NewBidirectional(
+		func() interface{} { return stream.Context() },
+		func() (interface{}, error) {
+			m := newRequest()
+			if err := stream.RecvMsg(m); err != nil {
+				return nil, err
+			}
+			return m, nil
+		},
+		stream.SendMsg,
+	)
+}
+
+// Context returns the context of the stream
+func (bs *BidirectionalStream) Context() context.Context {
+	if ctx, ok := bs.ctx().(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// Send sends x on the stream
+func (bs *BidirectionalStream) Send(x interface{}) error {
+	return bs.send(x)
+}
+
+// Recv receives the next message of the stream
+func (bs *BidirectionalStream) Recv() (interface{}, error) {
+	return bs.recv()
+}
+
+// UnaryStreamEndpoint returns streaming endpoint calling e for every request and
+// sending its response, the stream fails with the first error of e
+func UnaryStreamEndpoint(e endpoint.Endpoint) StreamEndpoint {
+	return func(ctx context.Context, requests <-chan interface{}, responses chan<- interface{}) error {
+		for req := range requests {
+			resp, err := e(ctx, req)
+			if err != nil {
+				return err
+			}
+			select {
+			case responses <- resp:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+}
+
+func nopStreamCodec(_ context.Context, m interface{}) (interface{}, error) {
+	return m, nil
+}
@@ -0,0 +1,97 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	logkit "github.com/go-kit/kit/log"
+)
+
+// Level is the minimum level of logged entries, it can be changed at runtime with SetLevel
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+	LevelCritical
+)
+
+var levelNames = map[Level]string{
+	LevelDebug:    "debug",
+	LevelInfo:     "info",
+	LevelWarning:  "warning",
+	LevelError:    "error",
+	LevelCritical: "critical",
+}
+
+// levelKeys are the log keys of each level, e.g. logger.Log(LogError, msg)
+var levelKeys = map[string]Level{
+	LogDebug:    LevelDebug,
+	LogInfo:     LevelInfo,
+	LogWarning:  LevelWarning,
+	LogError:    LevelError,
+	LogCritical: LevelCritical,
+}
+
+var currentLevel int32
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel returns the level named s, e.g. "info" or "[INFO]"
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.Trim(strings.TrimSpace(s), "[]"))
+	if s == "warn" {
+		s = "warning"
+	}
+	for l, name := range levelNames {
+		if name == s {
+			return l, nil
+		}
+	}
+	return LevelDebug, fmt.Errorf("unknown log level %q", s)
+}
+
+// SetLevel sets the minimum level logged by the loggers of this package
+func SetLevel(l Level) {
+	atomic.StoreInt32(&currentLevel, int32(l))
+}
+
+// GetLevel returns the minimum level logged by the loggers of this package
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&currentLevel))
+}
+
+type levelFilter struct {
+	next logkit.Logger
+}
+
+// LevelFilter returns logger dropping the entries below GetLevel.
+// The level of an entry is given by its LogDebug, LogInfo, LogWarning, LogError
+// or LogCritical key, entries without one are always logged.
+func LevelFilter(logger logkit.Logger) logkit.Logger {
+	return &levelFilter{next: logger}
+}
+
+func (f *levelFilter) Log(keyvals ...interface{}) error {
+	min := GetLevel()
+	if min > LevelDebug {
+		for i := 0; i < len(keyvals); i += 2 {
+			key, ok := keyvals[i].(string)
+			if !ok {
+				continue
+			}
+			if l, ok := levelKeys[key]; ok && l < min {
+				return nil
+			}
+		}
+	}
+	return f.next.Log(keyvals...)
+}
@@ -2,7 +2,6 @@ package log
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -30,6 +29,12 @@ type LogUserRequest struct {
 }
 
 func getIPClient(w http.ResponseWriter, r *http.Request) string {
+	return GetIPClient(r)
+}
+
+// GetIPClient returns the client ip of r, read from X-Forwarded-For,
+// X-Real-Ip or the remote address
+func GetIPClient(r *http.Request) string {
 	xForwardedFor := r.Header.Get("X-Forwarded-For")
 	ip := strings.TrimSpace(strings.Split(xForwardedFor, ",")[0])
 	if ip != "" {
@@ -48,6 +53,9 @@ func getIPClient(w http.ResponseWriter, r *http.Request) string {
 	return "127.0.0.1"
 }
 
+// BodyContent is the body of the token auth requests.
+//
+// Deprecated: request bodies are redacted by DefaultRedactor.
 type BodyContent struct {
 	Scope           string `json:"scope"`
 	ResponseType    string `json:"response_type"`
@@ -80,13 +88,7 @@ func LogRequestClient(w http.ResponseWriter, r *http.Request) LogUserRequest {
 			body, _ = ioutil.ReadAll(r.Body)
 			r.Body = ioutil.NopCloser(bytes.NewReader(body))
 
-			// set user secret to empty string in log
-			var b BodyContent
-			if r.URL.Path == "/token/auth" {
-				_ = json.Unmarshal(body, &b)
-				b.UserSecret = ""
-				body, _ = json.Marshal(b)
-			}
+			body = DefaultRedactor.RedactBody(r.Header.Get("Content-Type"), body)
 		}
 
 		//token := r.Header.Get("Authorization")
@@ -95,7 +97,7 @@ func LogRequestClient(w http.ResponseWriter, r *http.Request) LogUserRequest {
 			PathURL:   r.URL.Path,
 			Method:    r.Method,
 			IPAddress: getIPClient(w, r),
-			Headers:   fmt.Sprintf("%+v", r.Header),
+			Headers:   fmt.Sprintf("%+v", DefaultRedactor.RedactHeader(r.Header)),
 			Content:   string(body),
 		}
 		return logResp
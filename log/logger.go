@@ -13,6 +13,7 @@ import (
 
 	logkit "github.com/go-kit/kit/log"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
@@ -81,7 +82,7 @@ func File(file string) {
 // Logger returns default logger
 func Logger() logkit.Logger {
 	File(logFile)
-	logger := logkit.NewLogfmtLogger(NewDefaultLogWriter())
+	logger := LevelFilter(logkit.NewLogfmtLogger(NewDefaultLogWriter()))
 	logger = logkit.With(logger, LogCaller, logkit.DefaultCaller)
 
 	return logger
@@ -89,7 +90,7 @@ func Logger() logkit.Logger {
 
 // StdLogger returns logger to stderr
 func StdLogger() logkit.Logger {
-	logger := logkit.NewLogfmtLogger(os.Stderr)
+	logger := LevelFilter(logkit.NewLogfmtLogger(os.Stderr))
 	logger = logkit.With(logger, LogTime, logkit.DefaultTimestampUTC, LogCaller, logkit.DefaultCaller)
 
 	return logger
@@ -97,7 +98,7 @@ func StdLogger() logkit.Logger {
 
 // StdLoggerConf returns logger to stderr with config
 func StdLoggerConf(conf ConfigLog) logkit.Logger {
-	logger := logkit.NewLogfmtLogger(os.Stderr)
+	logger := LevelFilter(logkit.NewLogfmtLogger(os.Stderr))
 	logger = logkit.With(logger, LogTime, logkit.DefaultTimestampUTC, LogCaller, logkit.Caller(conf.Caller))
 
 	return logger
@@ -106,14 +107,14 @@ func StdLoggerConf(conf ConfigLog) logkit.Logger {
 // FileLogger returns file logger
 func FileLogger(file string) logkit.Logger {
 	File(file)
-	logger := logkit.NewLogfmtLogger(NewDefaultLogWriter())
+	logger := LevelFilter(logkit.NewLogfmtLogger(NewDefaultLogWriter()))
 	logger = logkit.With(logger, LogCaller, logkit.DefaultCaller)
 
 	return logger
 }
 
 func StackDriverLogger() logkit.Logger {
-	logger := NewSDLogger(os.Stdout)
+	logger := LevelFilter(NewSDLogger(os.Stdout))
 	logger = logkit.With(logger, LogTime, logkit.DefaultTimestampUTC, LogCaller, logkit.DefaultCaller)
 
 	return logger
@@ -154,19 +155,21 @@ func (cslog *ConsoleLog) GetTimeSince() float64 {
 }
 
 func GetTraceID(ctx context.Context) string {
-	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if ok {
 		if val, exists := md.HeaderMD["trace.id"]; exists {
 			return val[0]
-		} else {
-			traceID, _ := uuid.New()
-			trid := traceID.String()
-			md.HeaderMD.Append("trace.id", trid)
-			return trid
 		}
 	}
+	if val := incomingMetadata(ctx, "trace.id"); val != "" {
+		return val
+	}
 
 	traceID, _ := uuid.New()
 	trid := traceID.String()
+	if ok {
+		md.HeaderMD.Append("trace.id", trid)
+	}
 	return trid
 }
 
@@ -176,10 +179,23 @@ func GetRequestID(ctx context.Context) string {
 			return val[0]
 		}
 	}
+	if val := incomingMetadata(ctx, "transaction.id"); val != "" {
+		return val
+	}
 	txID, _ := uuid.New()
 	return txID.String()
 }
 
+// incomingMetadata returns the first value of key sent by the grpc client
+func incomingMetadata(ctx context.Context, key string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if val := md.Get(key); len(val) > 0 {
+			return val[0]
+		}
+	}
+	return ""
+}
+
 func GetTraceIDFromHTTPContext(req *http.Request) string {
 	if val := req.Header.Get("trace.id"); val != "" {
 		return val
@@ -0,0 +1,186 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces the redacted values of logged payloads
+const RedactedValue = "[REDACTED]"
+
+// Redactor masks the secrets of logged headers and payloads
+type Redactor struct {
+	// Headers are the header or metadata names whose values are redacted, case-insensitive
+	Headers []string `json:"headers"`
+	// JSONPaths are dot separated paths of json values, e.g. "user.password" or "items.*.token",
+	// "*" matches any object key or array item
+	JSONPaths []string `json:"json_paths"`
+	// Fields are json keys or proto field names redacted at any depth, case-insensitive
+	Fields []string `json:"fields"`
+}
+
+// DefaultRedactor redacts credentials sent by the services
+var DefaultRedactor = Redactor{
+	Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "Grpcgateway-Authorization", "Grpcgateway-Cookie"},
+	Fields:  []string{"password", "user_secret", "client_secret", "secret", "otp", "access_token", "refresh_token", "id_token"},
+}
+
+// Merge returns redactor redacting the values of r and o
+func (r Redactor) Merge(o Redactor) Redactor {
+	return Redactor{
+		Headers:   append(append([]string{}, r.Headers...), o.Headers...),
+		JSONPaths: append(append([]string{}, r.JSONPaths...), o.JSONPaths...),
+		Fields:    append(append([]string{}, r.Fields...), o.Fields...),
+	}
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValues returns the values of the name header, redacted when the header is secret
+func (r Redactor) redactValues(name string, values []string) []string {
+	if !containsFold(r.Headers, name) {
+		return values
+	}
+	redacted := make([]string, len(values))
+	for i := range redacted {
+		redacted[i] = RedactedValue
+	}
+	return redacted
+}
+
+// RedactHeader returns copy of h with the values of the secret headers redacted
+func (r Redactor) RedactHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		out[name] = r.redactValues(name, values)
+	}
+	return out
+}
+
+// RedactMetadata returns copy of the grpc metadata md with the values of the secret keys redacted
+func (r Redactor) RedactMetadata(md map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(md))
+	for key, values := range md {
+		out[key] = r.redactValues(key, values)
+	}
+	return out
+}
+
+// RedactValue redacts v, a value decoded from json, in place and returns it
+func (r Redactor) RedactValue(v interface{}) interface{} {
+	return r.redact(v, nil, r.jsonPaths())
+}
+
+// jsonPaths returns the segments of the json paths, a leading "$." is ignored
+func (r Redactor) jsonPaths() [][]string {
+	paths := make([][]string, 0, len(r.JSONPaths))
+	for _, p := range r.JSONPaths {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, "$"), ".")
+		if p != "" {
+			paths = append(paths, strings.Split(p, "."))
+		}
+	}
+	return paths
+}
+
+// redact redacts v found at path
+func (r Redactor) redact(v interface{}, path []string, paths [][]string) interface{} {
+	if len(path) > 0 && (containsFold(r.Fields, path[len(path)-1]) || matchJSONPath(path, paths)) {
+		return RedactedValue
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = r.redact(value, append(path, key), paths)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = r.redact(value, append(path, "*"), paths)
+		}
+	}
+	return v
+}
+
+// matchJSONPath reports whether path is one of paths, array items only match "*"
+func matchJSONPath(path []string, paths [][]string) bool {
+	for _, p := range paths {
+		if len(p) != len(path) {
+			continue
+		}
+		matched := true
+		for i := range p {
+			if p[i] != "*" && p[i] != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactJSON returns the json body with its secret values redacted
+func (r Redactor) RedactJSON(body []byte) ([]byte, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(r.RedactValue(v))
+}
+
+// RedactForm returns the url encoded form body with its secret values redacted,
+// form keys are matched as top level json keys
+func (r Redactor) RedactForm(body []byte) ([]byte, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	paths := r.jsonPaths()
+	for key := range values {
+		if containsFold(r.Fields, key) || matchJSONPath([]string{key}, paths) {
+			values[key] = []string{RedactedValue}
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+// RedactBody returns body of the content type redacted, json and url encoded forms are
+// redacted by key, other bodies are returned as is. A body that can not be parsed is
+// replaced by RedactedValue, e.g. a truncated json body.
+func (r Redactor) RedactBody(contentType string, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	var redacted []byte
+	var err error
+	switch {
+	case strings.Contains(contentType, "json"):
+		redacted, err = r.RedactJSON(body)
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		redacted, err = r.RedactForm(body)
+	default:
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			redacted, err = r.RedactJSON(body)
+		} else {
+			return body
+		}
+	}
+	if err != nil {
+		return []byte(RedactedValue)
+	}
+	return redacted
+}
@@ -0,0 +1,24 @@
+package log
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	r := DefaultRedactor.Merge(Redactor{JSONPaths: []string{"$.user.pin", "items.*.token"}})
+
+	body, err := r.RedactJSON([]byte(`{"user":{"pin":"1234","name":"a","password":"p"},"items":[{"token":"t","id":1}],"token":"keep"}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"user":{"pin":"[REDACTED]","name":"a","password":"[REDACTED]"},"items":[{"token":"[REDACTED]","id":1}],"token":"keep"}`, string(body))
+
+	require.Equal(t, "a=1&user_secret=%5BREDACTED%5D", string(r.RedactBody("application/x-www-form-urlencoded", []byte("user_secret=s&a=1"))))
+	require.Equal(t, RedactedValue, string(r.RedactBody("application/json", []byte(`{"password":"tru`))))
+	require.Equal(t, "plain", string(r.RedactBody("text/plain", []byte("plain"))))
+
+	h := r.RedactHeader(http.Header{"Authorization": {"Bearer t"}, "Accept": {"*/*"}})
+	require.Equal(t, []string{RedactedValue}, h["Authorization"])
+	require.Equal(t, []string{"*/*"}, h["Accept"])
+}
@@ -2,7 +2,8 @@ package microservice
 
 import (
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+
+	uerrors "github.com/uninus-opensource/uninus-go-architect-common/errors"
 )
 
 type msgError string
@@ -14,7 +15,17 @@ const (
 	msgUnauthorizedAccess  msgError = "Unauthorized access"
 	msgJWTExpired          msgError = "JWT Token is expired"
 	msgTokenEmpty          msgError = "token up for parsing was not passed through the context"
+)
 
+// application error codes of the auth errors, sent as ErrorInfo reason.
+// The errors keep the messages of plain status errors, their codes are read with errors.AppCode.
+const (
+	CodeInvalidToken        = "INVALID_TOKEN"
+	CodeInvalidCode         = "INVALID_CODE"
+	CodeInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeJWTExpired          = "JWT_EXPIRED"
+	CodeTokenEmpty          = "TOKEN_EMPTY"
 )
 
 var (
@@ -27,17 +38,17 @@ var (
 	}
 
 	//ErrorInvalidToken is response for token is invalid
-	ErrorInvalidToken = status.Error(codes.PermissionDenied, "Token is invalid")
+	ErrorInvalidToken = uerrors.NewAppError(codes.PermissionDenied, CodeInvalidToken, "Token is invalid").GRPCStatus().Err()
 	// ErrorInvalidCode is response for Code is invalid
-	ErrorInvalidCode = status.Error(codes.PermissionDenied, "Code is invalid")
+	ErrorInvalidCode = uerrors.NewAppError(codes.PermissionDenied, CodeInvalidCode, "Code is invalid").GRPCStatus().Err()
 	// ErrorInvalidRefreshToken is response for Refresh token is invalid
-	ErrorInvalidRefreshToken = status.Error(codes.PermissionDenied, "Refresh token is invalid")
+	ErrorInvalidRefreshToken = uerrors.NewAppError(codes.PermissionDenied, CodeInvalidRefreshToken, "Refresh token is invalid").GRPCStatus().Err()
 	//ErrUnauthorized is error for unauthorized access
-	ErrUnauthorized = status.Error(codes.PermissionDenied, "Unauthorized access")
+	ErrUnauthorized = uerrors.NewAppError(codes.PermissionDenied, CodeUnauthorized, "Unauthorized access").GRPCStatus().Err()
 	//ErrJWTExpired is error for token expired
-	ErrJWTExpired = status.Error(codes.PermissionDenied, "JWT Token is expired")
+	ErrJWTExpired = uerrors.NewAppError(codes.PermissionDenied, CodeJWTExpired, "JWT Token is expired").GRPCStatus().Err()
 	//ErrTokenEmpty is error for token is empty
-	ErrTokenEmpty = status.Error(codes.PermissionDenied, "token up for parsing was not passed through the context")
+	ErrTokenEmpty = uerrors.NewAppError(codes.PermissionDenied, CodeTokenEmpty, "token up for parsing was not passed through the context").GRPCStatus().Err()
 )
 
 // FilterType ..
@@ -80,6 +91,8 @@ var (
 	CtxGroupName = contextKey("group_name")
 	//CtxRequestID is context key for requestID
 	CtxRequestID = contextKey("request_id")
+	//CtxTraceID is context key for traceID
+	CtxTraceID = contextKey("trace_id")
 	// CtxRequestUUID is context key for user UUID which request
 	CtxRequestUUID = contextKey("request_uuid")
 	// CtxRequestName is context key for user_name which request
@@ -92,4 +105,6 @@ var (
 	CtxSecurityPolicy = contextKey("security_policy")
 	//CtxUname is context key for uname of the user
 	CtxUname = contextKey("uname")
+	// CtxPeerIdentity is context key for identity of the service calling with mtls
+	CtxPeerIdentity = contextKey("peer_identity")
 )
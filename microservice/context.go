@@ -79,6 +79,16 @@ func GetRequestIDByContext(ctx context.Context) string {
 	return GetContextString(ctx, CtxRequestID)
 }
 
+// SetTraceIDToContext stores the trace id shared by every service handling a request
+func SetTraceIDToContext(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, CtxTraceID, traceID)
+}
+
+// GetTraceIDByContext returns the trace id stored by SetTraceIDToContext
+func GetTraceIDByContext(ctx context.Context) string {
+	return GetContextString(ctx, CtxTraceID)
+}
+
 func SetValueToContext(ctx context.Context, key contextKey, val interface{}) context.Context {
 	return context.WithValue(ctx, key, val)
 }
@@ -108,3 +118,34 @@ func SetRequestContext(ctx context.Context, requestUUID uuid.UUID, requestID, re
 	ctx = context.WithValue(ctx, CtxUserID, requestName)
 	return ctx
 }
+
+// PeerIdentity is the identity of a service taken from its verified mtls certificate
+type PeerIdentity struct {
+	// SPIFFEID is the first spiffe:// uri of the certificate, e.g. spiffe://uninus.id/ns/prod/sa/auth
+	SPIFFEID   string
+	URIs       []string
+	DNSNames   []string
+	CommonName string
+}
+
+// Names returns the uris, dns names and common name of the identity
+func (p PeerIdentity) Names() []string {
+	var names []string
+	names = append(names, p.URIs...)
+	names = append(names, p.DNSNames...)
+	if p.CommonName != "" {
+		names = append(names, p.CommonName)
+	}
+	return names
+}
+
+// SetPeerIdentityToContext set identity of the calling service to context
+func SetPeerIdentityToContext(ctx context.Context, identity PeerIdentity) context.Context {
+	return context.WithValue(ctx, CtxPeerIdentity, identity)
+}
+
+// GetPeerIdentityByContext return identity of the calling service, false when the call is not mtls
+func GetPeerIdentityByContext(ctx context.Context) (PeerIdentity, bool) {
+	identity, ok := ctx.Value(CtxPeerIdentity).(PeerIdentity)
+	return identity, ok
+}
@@ -18,6 +18,7 @@ import (
 
 
 	"github.com/uninus-opensource/uninus-go-architect-common/flags"
+	uerrors "github.com/uninus-opensource/uninus-go-architect-common/errors"
 )
 
 // etcdv3
@@ -130,8 +131,13 @@ func GoWithRecover(function func(), recoverFunc RecoveryHandlerFunc) {
 	}()
 }
 
-
+// formatingMsgError returns the auth error matching err. Errors already carrying
+// an application code are returned as is, the message is only matched for
+// services not sending status details yet.
 func formatingMsgError(err error) error {
+	if uerrors.AppCode(err) != "" {
+		return err
+	}
 	for _, v := range listFormatingMsgErrors {
 		if strings.Contains(err.Error(), v.String()) {
 			return v.ToError()
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/microservice"
+	"github.com/uninus-opensource/uninus-go-architect-common/uuid"
+)
+
+// DefaultAPIKeyHeader is the header and metadata key read by DefaultKey
+const DefaultAPIKeyHeader = "x-api-key"
+
+// KeyFunc returns the key identifying the caller of a request,
+// requests with an empty key are not limited
+type KeyFunc func(ctx context.Context) string
+
+type contextKey string
+
+// ctxHTTPRequest is the context key of the request handled by HTTPMiddleware
+const ctxHTTPRequest = contextKey("http_request")
+
+func httpRequest(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(ctxHTTPRequest).(*http.Request)
+	return r
+}
+
+func incomingMetadata(ctx context.Context, key string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// UserKey returns the user uuid set by microservice.AuthenticateMiddleware
+func UserKey(ctx context.Context) string {
+	if uid := microservice.GetContextUUID(ctx, microservice.CtxUserUUID); uid != uuid.Empty {
+		return "user:" + uid.String()
+	}
+	return ""
+}
+
+// APIKey returns KeyFunc reading the api key from header, in the http request
+// or in the grpc metadata. The key is hashed, it never reaches the limiter store.
+func APIKey(header string) KeyFunc {
+	return func(ctx context.Context) string {
+		var key string
+		if r := httpRequest(ctx); r != nil {
+			key = r.Header.Get(header)
+		} else {
+			key = incomingMetadata(ctx, header)
+		}
+		if key == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:])
+	}
+}
+
+// ClientIP returns the ip of the client calling directly, X-Forwarded-For and X-Real-Ip
+// are ignored since any client can set them. Use ClientIPKey behind proxies or the grpc gateway.
+// The ip logged by log.GetIPClient is not used: it trusts the headers of every client,
+// which could then escape their limit by sending a new ip on each request.
+func ClientIP(ctx context.Context) string {
+	return clientIP(ctx, nil)
+}
+
+// ClientIPKey returns KeyFunc identifying the client by ip. The forwarded ip of the
+// X-Forwarded-For header or metadata, else of X-Real-Ip, is only honoured from the
+// trusted proxies, given as ip or cidr, e.g. "127.0.0.1" for the grpc gateway of the service.
+func ClientIPKey(trustedProxies ...string) (KeyFunc, error) {
+	var trusted []*net.IPNet
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("ratelimit: invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid trusted proxy %q: %w", proxy, err)
+		}
+		trusted = append(trusted, network)
+	}
+	return func(ctx context.Context) string {
+		return clientIP(ctx, trusted)
+	}, nil
+}
+
+func clientIP(ctx context.Context, trusted []*net.IPNet) string {
+	var remote, forwarded, realIP string
+	if r := httpRequest(ctx); r != nil {
+		remote = hostIP(r.RemoteAddr)
+		forwarded = r.Header.Get("X-Forwarded-For")
+		realIP = r.Header.Get("X-Real-Ip")
+	} else {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			remote = hostIP(p.Addr.String())
+		}
+		forwarded = incomingMetadata(ctx, "x-forwarded-for")
+		realIP = incomingMetadata(ctx, "x-real-ip")
+	}
+
+	ip := remote
+	if isTrusted(ip, trusted) {
+		// walk the proxies from the closest, the first untrusted one is the client
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !isTrusted(hop, trusted) {
+				break
+			}
+		}
+		if ip == remote && strings.TrimSpace(realIP) != "" {
+			ip = strings.TrimSpace(realIP)
+		}
+	}
+	if ip == "" {
+		return ""
+	}
+	return "ip:" + ip
+}
+
+func hostIP(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if ip, _, err := net.SplitHostPort(addr); err == nil {
+		return ip
+	}
+	return addr
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// FirstKey returns the first non empty key of fns
+func FirstKey(fns ...KeyFunc) KeyFunc {
+	return func(ctx context.Context) string {
+		for _, fn := range fns {
+			if key := fn(ctx); key != "" {
+				return key
+			}
+		}
+		return ""
+	}
+}
+
+// DefaultKey identifies the caller by user, then api key, then client ip
+var DefaultKey = FirstKey(UserKey, APIKey(DefaultAPIKeyHeader), ClientIP)
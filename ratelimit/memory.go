@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type window struct {
+	start     time.Time
+	prev, cur int
+}
+
+type memoryLimiter struct {
+	rule Rule
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+// NewMemoryLimiter returns limiter keeping its state in memory,
+// requests are limited per process
+func NewMemoryLimiter(rule Rule) Limiter {
+	return &memoryLimiter{
+		rule:    rule,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		windows: make(map[string]*window),
+	}
+}
+
+func (m *memoryLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	if !m.rule.valid() {
+		return false, 0, ErrInvalidRule
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+	if m.rule.Algorithm == SlidingWindow {
+		return m.allowWindow(key, now)
+	}
+	return m.allowBucket(key, now)
+}
+
+func (m *memoryLimiter) allowBucket(key string, now time.Time) (bool, time.Duration, error) {
+	capacity := float64(m.rule.burst())
+	limit, period := float64(m.rule.Limit), float64(m.rule.Period)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))*limit/period)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration(math.Ceil((1 - b.tokens) * period / limit)), nil
+}
+
+func (m *memoryLimiter) allowWindow(key string, now time.Time) (bool, time.Duration, error) {
+	period := m.rule.Period
+	start := now.Truncate(period)
+
+	w, ok := m.windows[key]
+	if !ok {
+		w = &window{start: start}
+		m.windows[key] = w
+	}
+	switch {
+	case w.start.Equal(start):
+	case w.start.Add(period).Equal(start):
+		w.start, w.prev, w.cur = start, w.cur, 0
+	default:
+		w.start, w.prev, w.cur = start, 0, 0
+	}
+
+	allowed, retryAfter := slidingWindow(m.rule.Limit, period, now.Sub(start), w.prev, w.cur)
+	if allowed {
+		w.cur++
+	}
+	return allowed, retryAfter, nil
+}
+
+// slidingWindow reports whether one more request fits in the window ending
+// elapsed after the start of the current fixed window
+func slidingWindow(limit int, period, elapsed time.Duration, prev, cur int) (bool, time.Duration) {
+	remaining := period - elapsed
+	count := float64(prev)*float64(remaining)/float64(period) + float64(cur)
+	if count+1 <= float64(limit) {
+		return true, 0
+	}
+
+	// wait until enough requests slid out, when the current window is
+	// full its requests are the previous ones of the next window
+	free := limit - 1 - cur
+	if free < 0 {
+		wait := float64(remaining) + float64(period)*float64(-free)/float64(cur)
+		return false, time.Duration(math.Ceil(wait))
+	}
+	wait := float64(remaining) - float64(free)*float64(period)/float64(prev)
+	return false, time.Duration(math.Ceil(wait))
+}
+
+// sweep drops state that would be back to its initial value, at most once per period
+func (m *memoryLimiter) sweep(now time.Time) {
+	period := m.rule.Period
+	if now.Sub(m.lastSweep) < period {
+		return
+	}
+	m.lastSweep = now
+
+	refill := m.rule.refill()
+	for key, b := range m.buckets {
+		if now.Sub(b.last) > refill {
+			delete(m.buckets, key)
+		}
+	}
+	for key, w := range m.windows {
+		if now.Sub(w.start) > 2*period {
+			delete(m.windows, key)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	uerrors "github.com/uninus-opensource/uninus-go-architect-common/errors"
+)
+
+// CodeRateLimited is the application error code of limited requests
+const CodeRateLimited = "RATE_LIMITED"
+
+// ErrLimited returns the error sent to limited callers, a ResourceExhausted
+// status telling the client to retry after retryAfter
+func ErrLimited(retryAfter time.Duration) error {
+	return uerrors.NewAppError(codes.ResourceExhausted, CodeRateLimited, "Too many requests").
+		WithRetryDelay(retryAfter)
+}
+
+// limit reports whether ctx's caller is over the limit and when it may retry.
+// Requests are allowed when the limiter fails, so a redis outage does not
+// take the service down.
+func limit(ctx context.Context, limiter Limiter, key KeyFunc) (bool, time.Duration) {
+	k := key(ctx)
+	if k == "" {
+		return false, 0
+	}
+	allowed, retryAfter, err := limiter.Allow(ctx, k)
+	if err != nil || allowed {
+		return false, 0
+	}
+	return true, retryAfter
+}
+
+// Middleware returns go-kit middleware limiting the callers identified by key
+func Middleware(limiter Limiter, key KeyFunc) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if limited, retryAfter := limit(ctx, limiter, key); limited {
+				return nil, ErrLimited(retryAfter)
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// UnaryServerInterceptor returns grpc interceptor limiting the callers identified by key
+func UnaryServerInterceptor(limiter Limiter, key KeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if limited, retryAfter := limit(ctx, limiter, key); limited {
+			return nil, ErrLimited(retryAfter)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns grpc interceptor limiting the streams opened by the callers identified by key
+func StreamServerInterceptor(limiter Limiter, key KeyFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if limited, retryAfter := limit(stream.Context(), limiter, key); limited {
+			return ErrLimited(retryAfter)
+		}
+		return handler(srv, stream)
+	}
+}
+
+// HTTPMiddleware returns http middleware limiting the callers identified by key,
+// limited requests are answered with 429 and Retry-After.
+// It can be passed to grcp.WithHTTPMiddleware.
+func HTTPMiddleware(limiter Limiter, key KeyFunc) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ctxHTTPRequest, r)
+			if limited, retryAfter := limit(ctx, limiter, key); limited {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
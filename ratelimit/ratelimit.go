@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Algorithm is the rate limiting algorithm of a Rule
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts up to Burst requests, refilled at Limit per Period
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit requests in any window of Period,
+	// weighting the previous fixed window by its overlap with the sliding one
+	SlidingWindow
+)
+
+// ErrInvalidRule is returned by limiters created with a rule allowing nothing
+var ErrInvalidRule = errors.New("ratelimit: rule limit must be positive and period at least 1ms")
+
+// Rule describes how many requests a key is allowed
+type Rule struct {
+	Algorithm Algorithm
+	// Limit is the number of requests allowed per Period
+	Limit  int
+	Period time.Duration
+	// Burst is the token bucket capacity, Limit when not set
+	Burst int
+}
+
+func (r Rule) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// refill returns the time an empty token bucket takes to be full again
+func (r Rule) refill() time.Duration {
+	return time.Duration(float64(r.Period) * float64(r.burst()) / float64(r.Limit))
+}
+
+// valid reports whether the rule allows requests, the period is sent
+// in milliseconds to redis and must be at least one
+func (r Rule) valid() bool {
+	return r.Limit > 0 && r.Period >= time.Millisecond
+}
+
+// Limiter decides whether requests identified by a key may proceed
+type Limiter interface {
+	// Allow takes one request for key, when it is not allowed
+	// it returns how long to wait before retrying
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
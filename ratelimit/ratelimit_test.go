@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/cache"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func testLimiter(t *testing.T, limiter Limiter, c *clock) {
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		allowed, _, err := limiter.Allow(ctx, "a")
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+	allowed, retryAfter, err := limiter.Allow(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.True(t, retryAfter > 0 && retryAfter <= 2*time.Second, retryAfter)
+
+	allowed, _, err = limiter.Allow(ctx, "b")
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	c.t = c.t.Add(retryAfter)
+	allowed, _, err = limiter.Allow(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
+
+func TestLimiters(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+	hc := cache.NewRedisHashCache(s.Addr(), "test")
+	defer hc.Close()
+
+	for _, algorithm := range []Algorithm{TokenBucket, SlidingWindow} {
+		rule := Rule{Algorithm: algorithm, Limit: 2, Period: time.Second}
+
+		c := &clock{t: time.Unix(1700000000, 0).Add(300 * time.Millisecond)}
+		memory := NewMemoryLimiter(rule).(*memoryLimiter)
+		memory.now = c.now
+		testLimiter(t, memory, c)
+
+		c = &clock{t: time.Unix(1700000000, 0).Add(300 * time.Millisecond)}
+		rl := NewRedisLimiter(client, "ratelimit", rule).(*redisLimiter)
+		rl.now = c.now
+		testLimiter(t, rl, c)
+		s.FlushAll()
+
+		c = &clock{t: time.Unix(1700000000, 0).Add(300 * time.Millisecond)}
+		limiter, err := NewHashCacheLimiter(hc, "ratelimit", rule)
+		require.NoError(t, err)
+		rl = limiter.(*redisLimiter)
+		rl.now = c.now
+		testLimiter(t, rl, c)
+		s.FlushAll()
+	}
+}
+
+func TestMiddlewares(t *testing.T) {
+	limiter := NewMemoryLimiter(Rule{Limit: 1, Period: time.Minute})
+
+	handler := HTTPMiddleware(limiter, DefaultKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Api-Key", "secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	endpoint := Middleware(limiter, func(ctx context.Context) string { return "user:1" })(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	_, err := endpoint(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = endpoint(context.Background(), nil)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestRuleValid(t *testing.T) {
+	_, _, err := NewMemoryLimiter(Rule{Limit: 1, Period: time.Microsecond}).Allow(context.Background(), "k")
+	require.Equal(t, ErrInvalidRule, err)
+}
+
+func TestKeys(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 2.2.2.2, 10.0.0.3")
+	r.Header.Set(DefaultAPIKeyHeader, "secret")
+	ctx := context.WithValue(context.Background(), ctxHTTPRequest, r)
+
+	require.Equal(t, "key:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", APIKey(DefaultAPIKeyHeader)(ctx))
+	require.Equal(t, "ip:10.0.0.2", ClientIP(ctx))
+
+	key, err := ClientIPKey("10.0.0.0/8")
+	require.NoError(t, err)
+	require.Equal(t, "ip:2.2.2.2", key(ctx))
+	key, err = ClientIPKey("192.168.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "ip:10.0.0.2", key(ctx))
+	_, err = ClientIPKey("proxy")
+	require.Error(t, err)
+
+	grpcCtx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}})
+	grpcCtx = metadata.NewIncomingContext(grpcCtx, metadata.Pairs("x-forwarded-for", "3.3.3.3"))
+	require.Equal(t, "ip:127.0.0.1", ClientIP(grpcCtx))
+	key, err = ClientIPKey("127.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "ip:3.3.3.3", key(grpcCtx))
+}
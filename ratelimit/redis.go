@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/uninus-opensource/uninus-go-architect-common/cache"
+)
+
+// tokenBucketScript takes one token from the bucket hash KEYS[1].
+// ARGV: tokens refilled per period, period in ms, capacity, now in ms, ttl in ms.
+// It returns {allowed, retry after in ms}.
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * limit / period)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * period / limit)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return {allowed, wait}
+`)
+
+// slidingWindowScript counts one request in the window counter KEYS[1],
+// weighting the previous window counter KEYS[2].
+// ARGV: limit, period in ms, ms elapsed in the current window.
+// It returns {allowed, retry after in ms}.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local remaining = period - tonumber(ARGV[3])
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+if prev * remaining / period + cur + 1 <= limit then
+	redis.call('INCR', KEYS[1])
+	redis.call('PEXPIRE', KEYS[1], 2 * period)
+	return {1, 0}
+end
+local free = limit - 1 - cur
+if free < 0 then
+	return {0, math.ceil(remaining + period * -free / cur)}
+end
+return {0, math.ceil(remaining - free * period / prev)}
+`)
+
+type redisLimiter struct {
+	client redis.Cmdable
+	prefix string
+	rule   Rule
+	now    func() time.Time
+}
+
+// NewRedisLimiter returns limiter keeping its state in redis,
+// requests are limited across every process sharing the client's redis.
+// The limiter clock is the local clock, processes should be time synchronized.
+func NewRedisLimiter(client redis.Cmdable, prefix string, rule Rule) Limiter {
+	return &redisLimiter{client: client, prefix: prefix, rule: rule, now: time.Now}
+}
+
+// NewHashCacheLimiter returns NewRedisLimiter using the redis client of hc,
+// a HashCache made by the cache package
+func NewHashCacheLimiter(hc cache.HashCache, prefix string, rule Rule) (Limiter, error) {
+	client, err := cache.RedisClient(hc)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisLimiter(client, prefix, rule), nil
+}
+
+func (r *redisLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	if !r.rule.valid() {
+		return false, 0, ErrInvalidRule
+	}
+	if err := ctx.Err(); err != nil {
+		return false, 0, err
+	}
+
+	now := r.now()
+	var res interface{}
+	var err error
+	if r.rule.Algorithm == SlidingWindow {
+		period := r.rule.Period
+		start := now.Truncate(period)
+		window := start.UnixNano() / int64(period)
+		// the hash tag keeps both windows in the same cluster slot
+		keys := []string{
+			fmt.Sprintf("%s:{%s}:%d", r.prefix, key, window),
+			fmt.Sprintf("%s:{%s}:%d", r.prefix, key, window-1),
+		}
+		res, err = slidingWindowScript.Run(r.client, keys, r.rule.Limit, milliseconds(period), milliseconds(now.Sub(start))).Result()
+	} else {
+		keys := []string{fmt.Sprintf("%s:{%s}", r.prefix, key)}
+		ttl := milliseconds(r.rule.refill()) + 1
+		res, err = tokenBucketScript.Run(r.client, keys, r.rule.Limit, milliseconds(r.rule.Period), r.rule.burst(), milliseconds(now.Sub(time.Unix(0, 0))), ttl).Result()
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("ratelimit: unexpected script result %v", res)
+	}
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}